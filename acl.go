@@ -0,0 +1,307 @@
+package memphis
+
+import (
+	"encoding/binary"
+	"os"
+	"sort"
+)
+
+// ACLTag identifies the kind of an ACL entry, using the values of Linux
+type ACLTag uint16
+
+// ACL entry kinds
+const (
+	ACLUserObj  ACLTag = 0x01
+	ACLUser     ACLTag = 0x02
+	ACLGroupObj ACLTag = 0x04
+	ACLGroup    ACLTag = 0x08
+	ACLMask     ACLTag = 0x10
+	ACLOther    ACLTag = 0x20
+)
+
+// Extended attributes through which ACLs are exposed
+const (
+	XattrACLAccess  = "system.posix_acl_access"
+	XattrACLDefault = "system.posix_acl_default"
+)
+
+// Permission bits requested of an access check
+const (
+	AccessRead  os.FileMode = 4
+	AccessWrite os.FileMode = 2
+	AccessExec  os.FileMode = 1
+)
+
+const (
+	aclXattrVersion = 2
+	aclUndefinedID  = 0xFFFFFFFF
+)
+
+// ACLEntry grants permissions to a user or group
+type ACLEntry struct {
+	Tag  ACLTag
+	ID   uint32      // ID is the uid or gid of ACLUser and ACLGroup entries
+	Perm os.FileMode // Perm holds read, write and execute bits
+}
+
+// ACL is a POSIX access control list. A file or directory without one is
+// governed by its mode alone.
+type ACL []ACLEntry
+
+func (a ACL) find(tag ACLTag) *ACLEntry {
+	for i := range a {
+		if a[i].Tag == tag {
+			return &a[i]
+		}
+	}
+	return nil
+}
+
+// minimal is true for ACLs that only mirror the owner, group and other mode bits
+func (a ACL) minimal() bool {
+	return a.find(ACLMask) == nil && len(a) == 3
+}
+
+// groupClass is the entry that the group bits of the mode correspond to
+func (a ACL) groupClass() *ACLEntry {
+	if m := a.find(ACLMask); m != nil {
+		return m
+	}
+	return a.find(ACLGroupObj)
+}
+
+func (a ACL) copy() ACL {
+	if a == nil {
+		return nil
+	}
+	return append(ACL{}, a...)
+}
+
+// validate checks the ACL is well formed and sorts its entries
+func (a ACL) validate() error {
+	counts := map[ACLTag]int{}
+	seen := map[ACLEntry]bool{}
+	for _, e := range a {
+		counts[e.Tag]++
+		if e.Perm&^7 != 0 {
+			return os.ErrInvalid
+		}
+		switch e.Tag {
+		case ACLUser, ACLGroup:
+			key := ACLEntry{Tag: e.Tag, ID: e.ID}
+			if seen[key] {
+				return os.ErrInvalid
+			}
+			seen[key] = true
+		case ACLUserObj, ACLGroupObj, ACLMask, ACLOther:
+		default:
+			return os.ErrInvalid
+		}
+	}
+	if counts[ACLUserObj] != 1 || counts[ACLGroupObj] != 1 || counts[ACLOther] != 1 || counts[ACLMask] > 1 {
+		return os.ErrInvalid
+	}
+	if counts[ACLUser]+counts[ACLGroup] > 0 && counts[ACLMask] == 0 {
+		return os.ErrInvalid
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Tag != a[j].Tag {
+			return a[i].Tag < a[j].Tag
+		}
+		return a[i].ID < a[j].ID
+	})
+	return nil
+}
+
+// encodeACL serializes an ACL in the Linux posix_acl xattr format
+func encodeACL(a ACL) []byte {
+	buf := make([]byte, 4+8*len(a))
+	binary.LittleEndian.PutUint32(buf[0:4], aclXattrVersion)
+	for i, e := range a {
+		b := buf[4+8*i:]
+		id := uint32(aclUndefinedID)
+		if e.Tag == ACLUser || e.Tag == ACLGroup {
+			id = e.ID
+		}
+		binary.LittleEndian.PutUint16(b[0:2], uint16(e.Tag))
+		binary.LittleEndian.PutUint16(b[2:4], uint16(e.Perm))
+		binary.LittleEndian.PutUint32(b[4:8], id)
+	}
+	return buf
+}
+
+// decodeACL parses an ACL from the Linux posix_acl xattr format
+func decodeACL(buf []byte) (ACL, error) {
+	if len(buf) < 4 || (len(buf)-4)%8 != 0 || binary.LittleEndian.Uint32(buf[0:4]) != aclXattrVersion {
+		return nil, os.ErrInvalid
+	}
+	a := make(ACL, 0, (len(buf)-4)/8)
+	for b := buf[4:]; len(b) > 0; b = b[8:] {
+		e := ACLEntry{
+			Tag:  ACLTag(binary.LittleEndian.Uint16(b[0:2])),
+			Perm: os.FileMode(binary.LittleEndian.Uint16(b[2:4])),
+		}
+		if e.Tag == ACLUser || e.Tag == ACLGroup {
+			e.ID = binary.LittleEndian.Uint32(b[4:8])
+		}
+		a = append(a, e)
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// aclFromMode builds the minimal ACL equivalent to a mode
+func aclFromMode(mode os.FileMode) ACL {
+	return ACL{
+		{Tag: ACLUserObj, Perm: (mode >> 6) & 7},
+		{Tag: ACLGroupObj, Perm: (mode >> 3) & 7},
+		{Tag: ACLOther, Perm: mode & 7},
+	}
+}
+
+// setACL replaces the access ACL, updating the mode to match it
+func (n *inode) setACL(a ACL) {
+	perm := a.find(ACLUserObj).Perm<<6 | a.groupClass().Perm<<3 | a.find(ACLOther).Perm
+	n.mode = n.mode&^os.ModePerm | perm
+	if a.minimal() {
+		n.acl = nil
+	} else {
+		n.acl = a
+	}
+}
+
+// syncACL updates the access ACL after a change to the permission bits of the mode
+func (n *inode) syncACL() {
+	if n.acl == nil {
+		return
+	}
+	n.acl.find(ACLUserObj).Perm = (n.mode >> 6) & 7
+	n.acl.groupClass().Perm = (n.mode >> 3) & 7
+	n.acl.find(ACLOther).Perm = n.mode & 7
+}
+
+// inheritACL applies a parent directory's default ACL to a newly created node,
+// limited by the permissions requested for it.
+func (n *inode) inheritACL(def ACL) {
+	if def == nil {
+		return
+	}
+	a := def.copy()
+	a.find(ACLUserObj).Perm &= (n.mode >> 6) & 7
+	a.groupClass().Perm &= (n.mode >> 3) & 7
+	a.find(ACLOther).Perm &= n.mode & 7
+	n.setACL(a)
+}
+
+// allows evaluates whether a user may access the node, following the POSIX ACL
+// access check algorithm. Without an ACL the mode bits are used.
+func (n *inode) allows(uid, gid uint32, want os.FileMode) bool {
+	if uid == 0 {
+		return true
+	}
+	a := n.acl
+	if a == nil {
+		a = aclFromMode(n.mode)
+	}
+	mask := os.FileMode(7)
+	if m := a.find(ACLMask); m != nil {
+		mask = m.Perm
+	}
+	if uid == n.uid {
+		return a.find(ACLUserObj).Perm&want == want
+	}
+	for _, e := range a {
+		if e.Tag == ACLUser && e.ID == uid {
+			return e.Perm&mask&want == want
+		}
+	}
+	matched := false
+	for _, e := range a {
+		if (e.Tag == ACLGroupObj && gid == n.gid) || (e.Tag == ACLGroup && e.ID == gid) {
+			matched = true
+			if e.Perm&mask&want == want {
+				return true
+			}
+		}
+	}
+	if matched {
+		return false
+	}
+	return a.find(ACLOther).Perm&want == want
+}
+
+// getACLXattr reads an ACL through its extended attribute
+func (n xattrNode) getACLXattr(attr string) ([]byte, error) {
+	a := n.acl
+	if attr == XattrACLDefault {
+		if n.dir == nil {
+			return nil, ErrNoAttr
+		}
+		a = n.dir.defaultACL
+	}
+	if a == nil {
+		return nil, ErrNoAttr
+	}
+	return encodeACL(a), nil
+}
+
+// setACLXattr replaces an ACL through its extended attribute. Only the owner
+// or a privileged user may change ACLs.
+func (n xattrNode) setACLXattr(attr string, value []byte, uid uint32, privileged bool) error {
+	if !privileged && uid != n.uid {
+		return ErrNotPermitted
+	}
+	if n.mode&os.ModeSymlink != 0 {
+		return ErrNotSupported
+	}
+	a, err := decodeACL(value)
+	if err != nil {
+		return err
+	}
+	if attr == XattrACLDefault {
+		if n.dir == nil {
+			return os.ErrPermission
+		}
+		n.dir.defaultACL = a
+		return nil
+	}
+	n.setACL(a)
+	return nil
+}
+
+// removeACLXattr removes an ACL through its extended attribute
+func (n xattrNode) removeACLXattr(attr string, uid uint32, privileged bool) error {
+	if !privileged && uid != n.uid {
+		return ErrNotPermitted
+	}
+	if attr == XattrACLDefault {
+		if n.dir == nil || n.dir.defaultACL == nil {
+			return ErrNoAttr
+		}
+		n.dir.defaultACL = nil
+		return nil
+	}
+	if n.acl == nil {
+		return ErrNoAttr
+	}
+	n.acl = nil
+	return nil
+}
+
+// aclXattrs lists the ACL extended attributes present on the node
+func (n xattrNode) aclXattrs() []string {
+	names := []string{}
+	if n.acl != nil {
+		names = append(names, XattrACLAccess)
+	}
+	if n.dir != nil && n.dir.defaultACL != nil {
+		names = append(names, XattrACLDefault)
+	}
+	return names
+}
+
+func isACLXattr(attr string) bool {
+	return attr == XattrACLAccess || attr == XattrACLDefault
+}
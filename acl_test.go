@@ -0,0 +1,85 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	root := New()
+	f, err := root.Create("f", 0, 0, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := root.AsBillyFS(0, 0)
+	acl := ACL{
+		{Tag: ACLUserObj, Perm: 6},
+		{Tag: ACLUser, ID: 5, Perm: 6},
+		{Tag: ACLGroupObj, Perm: 0},
+		{Tag: ACLMask, Perm: 4},
+		{Tag: ACLOther, Perm: 0},
+	}
+	if err := b.Setxattr("f", XattrACLAccess, encodeACL(acl), 0); err != nil {
+		t.Fatal(err)
+	}
+	if f.mode.Perm() != 0640 {
+		t.Errorf("mode %v after setting the ACL, want the mask as group bits", f.mode.Perm())
+	}
+	if !f.allows(5, 5, AccessRead) || f.allows(5, 5, AccessWrite) {
+		t.Error("named user entry is not limited by the mask")
+	}
+	if f.allows(6, 6, AccessRead) {
+		t.Error("a user without an entry was allowed to read")
+	}
+	if _, err := root.AsBillyFS(5, 5).Open("f"); err != nil {
+		t.Errorf("Open by a user granted read = %v", err)
+	}
+	if _, err := root.AsBillyFS(6, 6).Open("f"); !os.IsPermission(err) {
+		t.Errorf("Open by another user = %v, want ErrPermission", err)
+	}
+
+	// a directory's default ACL is inherited by entries created in it
+	d, err := root.CreateDir("d", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Setxattr("d", XattrACLDefault, encodeACL(acl), 0); err != nil {
+		t.Fatal(err)
+	}
+	child, err := d.Create("child", 0, 0, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := child.acl.find(ACLUser); e == nil || e.ID != 5 {
+		t.Errorf("created file has ACL %v, want the directory's default", child.acl)
+	}
+}
+
+func TestACLErrors(t *testing.T) {
+	root := New()
+	if _, err := root.Create("f", 0, 0, 0644); err != nil {
+		t.Fatal(err)
+	}
+	noMask := ACL{
+		{Tag: ACLUserObj, Perm: 6},
+		{Tag: ACLUser, ID: 5, Perm: 6},
+		{Tag: ACLGroupObj, Perm: 4},
+		{Tag: ACLOther, Perm: 4},
+	}
+	err := root.AsBillyFS(0, 0).Setxattr("f", XattrACLAccess, encodeACL(noMask), 0)
+	if !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("ACL with a named user but no mask = %v, want EINVAL", err)
+	}
+	if _, err := decodeACL([]byte{1, 2, 3}); !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("decoding a truncated ACL = %v, want ErrInvalid", err)
+	}
+	err = root.AsBillyFS(5, 5).Setxattr("f", XattrACLAccess, encodeACL(aclFromMode(0777)), 0)
+	if !errors.Is(err, ErrNotPermitted) {
+		t.Errorf("setting the ACL of another user's file = %v, want ErrNotPermitted", err)
+	}
+	if _, err := root.AsBillyFS(0, 0).Getxattr("f", XattrACLDefault); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("default ACL of a file = %v, want ErrNoAttr", err)
+	}
+}
@@ -13,35 +13,45 @@ import (
 
 // Billy wraps a filesystem subtree in the billy filesystem interface
 type Billy struct {
-	euid uint32 // euid is the effective user ID that the billy view will assume
-	egid uint32 // egid is the effective group ID that the billy view will assume
-	root *Tree
+	euid  uint32      // euid is the effective user ID that the billy view will assume
+	egid  uint32      // egid is the effective group ID that the billy view will assume
+	umask os.FileMode // umask is removed from the permissions of files the view creates
+	root  *Tree
 }
 
+// defaultUmask is the umask of new billy views. It masks nothing, so files are
+// created with the mode asked for unless a umask is set with SetUmask.
+const defaultUmask = 0
+
 // AsBillyFS provides a billy-comptatible view of the current memphis directory tree
 func (t *Tree) AsBillyFS(euid, egid uint32) *Billy {
 	return &Billy{
-		euid,
-		egid,
-		t,
+		euid:  euid,
+		egid:  egid,
+		umask: defaultUmask,
+		root:  t,
 	}
 }
 
-// Create makes a new empty file
-func (b *Billy) Create(filename string) (billy.File, error) {
-	dir, name := path.Split(filename)
-	treeRef := b.root.WalkDir(strings.Split(dir, Separator))
-	if treeRef == nil {
-		return nil, ErrNotDir
-	}
+// SetUmask sets the umask applied to files and directories created through the view,
+// returning the previous value.
+func (b *Billy) SetUmask(mask os.FileMode) os.FileMode {
+	old := b.umask
+	b.umask = mask & os.ModePerm
+	return old
+}
 
-	if _, ok := treeRef.files[name]; ok {
-		return nil, ErrExists
+// access checks the view's user may access a file or directory
+func (b *Billy) access(n *inode, want os.FileMode) error {
+	if !n.allows(b.euid, b.egid, want) {
+		return os.ErrPermission
 	}
+	return nil
+}
 
-	f := treeRef.Create(name, b.euid, b.egid, 0666)
-
-	return &BillyFile{f, 0}, nil
+// Create creates or truncates a file, as os.Create
+func (b *Billy) Create(filename string) (billy.File, error) {
+	return b.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 }
 
 // Open is a shortcut to openfile
@@ -49,124 +59,256 @@ func (b *Billy) Open(filename string) (billy.File, error) {
 	return b.OpenFile(filename, os.O_RDONLY, 0666)
 }
 
-// OpenFile opens a file for access
+// OpenFile opens a file for access. With O_CREATE a missing file is created with
+// perm, less the view's umask, including when the name is a symlink to a
+// missing file. O_EXCL fails if the name exists.
 func (b *Billy) OpenFile(filename string, flag int, perm os.FileMode) (billy.File, error) {
-	dir, name := path.Split(filename)
-	parent := b.root.WalkDir(strings.Split(dir, Separator))
-	if parent == nil {
-		return nil, os.ErrNotExist
+	f, err := b.openFile(filename, flag, perm)
+	if err != nil {
+		return nil, pathError("open", filename, err)
 	}
-	if _, dok := parent.directories[name]; dok {
-		return nil, os.ErrExist
+	return f, nil
+}
+
+func (b *Billy) openFile(filename string, flag int, perm os.FileMode) (*BillyFile, error) {
+	flags := 0
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		// as open(2), exclusive creation never follows a final symlink
+		flags = ResolveNoFollow
+	}
+	r, err := b.resolve(filename, flags)
+	if err != nil {
+		return nil, err
+	}
+	if r.dir != nil {
+		return nil, ErrIsDir
 	}
 
-	// If create mode - need parent but not file.
-	if (flag & os.O_CREATE) != 0 {
-		if _, fok := parent.files[name]; fok {
-			return nil, os.ErrExist
+	f := r.file
+	if f != nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, os.ErrExist
+	}
+	if f == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		if r.dirOnly {
+			return nil, ErrIsDir
+		}
+		if err := b.access(&r.parent.inode, AccessWrite|AccessExec); err != nil {
+			return nil, err
+		}
+		uid, gid, mode := r.parent.newOwner(b.euid, b.egid, perm, b.umask, false)
+		f, err := r.parent.Create(r.name, uid, gid, mode)
+		if err != nil {
+			return nil, err
 		}
-		return b.Create(filename)
+		return openHandle(f, flag), nil
 	}
 
-	f, d, err := b.root.Get(strings.Split(filename, Separator), true)
-	if err != nil {
+	want := AccessRead
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		want = AccessWrite
+	case os.O_RDWR:
+		want = AccessRead | AccessWrite
+	}
+	if err := b.access(&f.inode, want); err != nil {
 		return nil, err
 	}
-	if d != nil {
-		return nil, os.ErrExist
+	if flag&os.O_TRUNC != 0 && want&AccessWrite != 0 {
+		f.mu.Lock()
+		err := f.truncate(0)
+		f.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		f.changed(OpWrite)
 	}
 
-	return &BillyFile{f, 0}, nil
+	return openHandle(f, flag), nil
 }
 
 // Stat returns file metadata
 func (b *Billy) Stat(filename string) (os.FileInfo, error) {
-	return b.getFileInfo(filename, true)
+	fi, err := b.getFileInfo(filename, true)
+	if err != nil {
+		return nil, pathError("stat", filename, err)
+	}
+	return fi, nil
 }
 
 // Lstat provides symlink info
 func (b *Billy) Lstat(filename string) (os.FileInfo, error) {
-	return b.getFileInfo(filename, false)
+	fi, err := b.getFileInfo(filename, false)
+	if err != nil {
+		return nil, pathError("lstat", filename, err)
+	}
+	return fi, nil
 }
 
 func (b *Billy) getFileInfo(filename string, followLinks bool) (os.FileInfo, error) {
-	dir, name := path.Split(filename)
-	parent := b.root.WalkDir(strings.Split(dir, Separator))
-	if parent == nil {
-		return nil, os.ErrNotExist
+	flags := 0
+	if !followLinks {
+		flags = ResolveNoFollow
 	}
-	if f, ok := parent.files[name]; ok {
-		if ((f.Mode() & os.ModeSymlink) != 0) && followLinks {
-			// todo: maybe resolve circular links?
-			return b.getFileInfo(string(f.Bytes()), true)
-		}
-		return f, nil
+	r, err := b.resolve(filename, flags)
+	if err != nil {
+		return nil, err
 	}
-	if d := parent.WalkDir([]string{name}); d != nil {
-		return &DirMeta{name, d}, nil
+	if r.file != nil {
+		return r.file, nil
+	}
+	if r.dir != nil {
+		_, name := path.Split(filename)
+		return &DirMeta{name, r.dir}, nil
 	}
 	return nil, os.ErrNotExist
+}
 
+// resolve looks up a path, with the root of the view as the root for absolute paths and symlinks
+func (b *Billy) resolve(name string, flags int) (resolved, error) {
+	return b.root.lookupAs(b.root, name, flags, b.search)
 }
 
-// Rename a file
-func (b *Billy) Rename(oldpath, newpath string) error {
-	oldDir, oldName := path.Split(oldpath)
-	oldParent := b.root.WalkDir(strings.Split(oldDir, Separator))
-	if oldParent == nil {
-		return os.ErrNotExist
-	}
+// search checks the view may look up names in a directory
+func (b *Billy) search(d *Tree) error {
+	return b.access(&d.inode, AccessExec)
+}
 
-	newDir, newName := path.Split(newpath)
-	newParent := b.root.WalkDir(strings.Split(newDir, Separator))
-	if newParent == nil {
-		return os.ErrNotExist
+// dir looks up a directory
+func (b *Billy) dir(name string) (*Tree, error) {
+	r, err := b.resolve(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.file != nil {
+		return nil, ErrNotDir
 	}
-	if _, ok := newParent.files[newName]; ok {
-		return os.ErrExist
+	if r.dir == nil {
+		return nil, os.ErrNotExist
 	}
-	if _, ok := newParent.directories[newName]; ok {
-		return os.ErrExist
+	return r.dir, nil
+}
+
+// Rename moves a file or directory, replacing any file or empty directory at newpath
+func (b *Billy) Rename(oldpath, newpath string) error {
+	return b.RenameFlags(oldpath, newpath, 0)
+}
+
+// RenameFlags moves a file or directory as renameat2(2), with flags of RenameNoReplace
+// or RenameExchange.
+func (b *Billy) RenameFlags(oldpath, newpath string, flags int) error {
+	return linkError("rename", oldpath, newpath, b.rename(oldpath, newpath, flags))
+}
+
+func (b *Billy) rename(oldpath, newpath string, flags int) error {
+	oldDir, oldName := path.Split(path.Clean(oldpath))
+	oldParent, err := b.dir(oldDir)
+	if err != nil {
+		return err
 	}
 
-	// TODO: permissions check.
+	newDir, newName := path.Split(path.Clean(newpath))
+	newParent, err := b.dir(newDir)
+	if err != nil {
+		return err
+	}
 
-	if f, ok := oldParent.files[oldName]; ok {
-		// move file.
-		newParent.files[newName] = f
-		delete(oldParent.files, oldName)
-		return nil
-	} else if d, ok := oldParent.directories[oldName]; ok {
-		// move dir.
-		newParent.directories[newName] = d
-		delete(oldParent.directories, newName)
-		return nil
+	if err := b.access(&oldParent.inode, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	if err := b.access(&newParent.inode, AccessWrite|AccessExec); err != nil {
+		return err
 	}
-	return os.ErrNotExist
+	if oldParent != newParent {
+		// moving a directory rewrites its '..' entry
+		if d, ok := oldParent.directories[oldName]; ok {
+			if err := b.access(&d.inode, AccessWrite); err != nil {
+				return err
+			}
+		}
+		if d, ok := newParent.directories[newName]; ok && flags&RenameExchange != 0 {
+			if err := b.access(&d.inode, AccessWrite); err != nil {
+				return err
+			}
+		}
+	}
+	return oldParent.rename(oldName, newParent, newName, flags)
 }
 
 // Remove deletes a file
 func (b *Billy) Remove(filename string) error {
+	return pathError("remove", filename, b.remove(filename))
+}
+
+func (b *Billy) remove(filename string) error {
 	dir, name := path.Split(filename)
-	parent := b.root.WalkDir(strings.Split(dir, Separator))
-	if _, ok := parent.files[name]; ok {
-		// TODO: permissions.
-		delete(parent.files, name)
-		return nil
+	parent, err := b.dir(dir)
+	if err != nil {
+		return err
 	}
+	if err := b.access(&parent.inode, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	e := parent.entry(name)
+	if !e.exists() {
+		return os.ErrNotExist
+	}
+	// Directory must be empty
+	if e.dir != nil && len(e.dir.files)+len(e.dir.directories) > 0 {
+		return ErrNotEmpty
+	}
+	parent.removeEntry(name)
+	return nil
+}
 
-	if d := parent.WalkDir([]string{name}); d != nil {
-		// TODO: permissions.
+// RemoveAll removes a path and everything beneath it. It is not an error for the path not to exist.
+func (b *Billy) RemoveAll(name string) error {
+	return pathError("removeall", name, b.removeAll(name))
+}
 
-		// Directory must be empty
-		if len(d.files) > 0 || len(d.directories) > 0 {
-			return os.ErrExist
-		}
-		delete(parent.directories, name)
+func (b *Billy) removeAll(name string) error {
+	r, err := b.resolve(name, ResolveNoFollow)
+	if os.IsNotExist(err) {
 		return nil
 	}
+	if err != nil {
+		return err
+	}
+	if !r.exists() {
+		return nil
+	}
+	if r.parent == nil {
+		return os.ErrInvalid
+	}
+	if err := b.access(&r.parent.inode, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	if r.dir != nil {
+		if err := b.canEmpty(r.dir); err != nil {
+			return err
+		}
+	}
+	r.parent.removeEntry(r.name)
+	return nil
+}
 
-	return os.ErrNotExist
+// canEmpty checks the directories beneath d may have their entries removed
+func (b *Billy) canEmpty(d *Tree) error {
+	if len(d.files)+len(d.directories) == 0 {
+		return nil
+	}
+	if err := b.access(&d.inode, AccessWrite|AccessExec); err != nil {
+		return err
+	}
+	for _, sub := range d.directories {
+		sub.ready.Do(sub.deferred)
+		if err := b.canEmpty(sub); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Join constructs a path
@@ -176,42 +318,75 @@ func (b *Billy) Join(elem ...string) string {
 
 // TempFile create an empty tempfile
 func (b *Billy) TempFile(dir, prefix string) (billy.File, error) {
-	d := b.root.WalkDir(strings.Split(dir, Separator))
-	if d == nil {
-		return nil, os.ErrNotExist
+	if _, err := b.dir(dir); err != nil {
+		return nil, pathError("open", dir, err)
 	}
 	r := rand.Int()
 	n := fmt.Sprintf("%s%d", prefix, r)
-	return b.Create(path.Join(dir, n))
+	return b.OpenFile(path.Join(dir, n), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
 }
 
-// ReadDir lists directory contents
+// ReadDir lists directory contents, sorted by name
 func (b *Billy) ReadDir(path string) ([]os.FileInfo, error) {
-	d := b.root.WalkDir(strings.Split(path, Separator))
-	if d == nil {
-		return nil, os.ErrNotExist
+	d, err := b.dir(path)
+	if err == nil {
+		err = b.access(&d.inode, AccessRead)
 	}
-	items := make([]os.FileInfo, 0, len(d.directories)+len(d.files))
-	for name := range d.directories {
-		dir := d.WalkDir([]string{name})
-		items = append(items, &DirMeta{name, dir})
+	if err != nil {
+		return nil, pathError("open", path, err)
 	}
-	for _, file := range d.files {
-		items = append(items, file)
+	d.accessed(d.vol.atimePolicy(), d.vol.now())
+	names := d.Names()
+	items := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		items = append(items, d.info(name))
 	}
 	return items, nil
 }
 
+// OpenDir opens a directory for listing a few entries at a time
+func (b *Billy) OpenDir(path string) (*DirFile, error) {
+	d, err := b.dir(path)
+	if err == nil {
+		err = b.access(&d.inode, AccessRead)
+	}
+	if err != nil {
+		return nil, pathError("open", path, err)
+	}
+	return d.OpenDir(), nil
+}
+
 // MkdirAll creates a new directory
 func (b *Billy) MkdirAll(filename string, perm os.FileMode) error {
+	return pathError("mkdir", filename, b.mkdirAll(filename, perm))
+}
+
+func (b *Billy) mkdirAll(filename string, perm os.FileMode) error {
 	parts := strings.Split(filename, Separator)
 	cur := b.root
 	for _, p := range parts {
-		// todo: permissions
-		if next := cur.WalkDir([]string{p}); next != nil {
+		r, err := cur.lookupAs(b.root, p, 0, b.search)
+		if err != nil {
+			return err
+		}
+		switch {
+		case r.dir != nil:
+			cur = r.dir
+		case r.file != nil:
+			return ErrNotDir
+		case r.parent != cur || r.name != p:
+			// a dangling symlink is not replaced by a directory
+			return os.ErrExist
+		default:
+			if err := b.access(&cur.inode, AccessWrite|AccessExec); err != nil {
+				return err
+			}
+			uid, gid, mode := cur.newOwner(b.euid, b.egid, perm, b.umask, true)
+			next, err := cur.CreateDir(r.name, uid, gid, mode)
+			if err != nil {
+				return err
+			}
 			cur = next
-		} else {
-			cur = cur.CreateDir(p, b.euid, b.egid, perm.Perm()|os.ModeDir)
 		}
 	}
 	return nil
@@ -219,13 +394,15 @@ func (b *Billy) MkdirAll(filename string, perm os.FileMode) error {
 
 // Symlink creates a symbolic link
 func (b *Billy) Symlink(target, link string) error {
-	f, err := b.Create(link)
+	bf, err := b.openFile(link, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0777)
 	if err != nil {
-		return err
+		return linkError("symlink", target, link, err)
+	}
+	defer bf.Close()
+	if _, err := bf.Write([]byte(target)); err != nil {
+		return linkError("symlink", target, link, err)
 	}
-	bf := f.(*BillyFile)
-	bf.Write([]byte(target))
-	bf.File.mode |= os.ModeSymlink
+	bf.File.mode = os.ModeSymlink | os.ModePerm
 	return nil
 }
 
@@ -233,18 +410,24 @@ func (b *Billy) Symlink(target, link string) error {
 func (b *Billy) Readlink(link string) (string, error) {
 	f, err := b.getFileInfo(link, false)
 	if err != nil {
-		return "", err
+		return "", pathError("readlink", link, err)
 	}
-	//todo: validate read permission.
 	ffile, ok := f.(*File)
-	if !ok {
-		return "", os.ErrExist
+	if !ok || ffile.mode&os.ModeSymlink == 0 {
+		return "", pathError("readlink", link, os.ErrInvalid)
 	}
+	ffile.mu.Lock()
+	ffile.accessed(ffile.vol.atimePolicy(), ffile.vol.now())
+	ffile.mu.Unlock()
 	return string(ffile.Bytes()), nil
 }
 
 // Chmod changes file permissions
 func (b *Billy) Chmod(name string, mode os.FileMode) error {
+	return pathError("chmod", name, b.chmod(name, mode))
+}
+
+func (b *Billy) chmod(name string, mode os.FileMode) error {
 	f, err := b.getFileInfo(name, true)
 	if err != nil {
 		return err
@@ -255,26 +438,36 @@ func (b *Billy) Chmod(name string, mode os.FileMode) error {
 		if !ok {
 			return os.ErrInvalid
 		}
+		if b.euid != 0 && b.euid != fdir.Tree.uid {
+			return ErrNotPermitted
+		}
 		fdir.Tree.mode = mode
+		fdir.Tree.syncACL()
+		fdir.Tree.changed(OpChmod)
 		return nil
 	}
+	if b.euid != 0 && b.euid != ffile.uid {
+		return ErrNotPermitted
+	}
 	ffile.mode = mode
+	ffile.syncACL()
+	ffile.changed(OpChmod)
 	return nil
 }
 
 // Lchown changes symlink ownership
 func (b *Billy) Lchown(name string, uid, gid int) error {
-	return b.changeOwnership(name, uid, gid, false)
+	return pathError("lchown", name, b.changeOwnership(name, uid, gid, false))
 }
 
 // Chown changes file ownership
 func (b *Billy) Chown(name string, uid, gid int) error {
-	return b.changeOwnership(name, uid, gid, true)
+	return pathError("chown", name, b.changeOwnership(name, uid, gid, true))
 }
 
 func (b *Billy) changeOwnership(name string, uid, gid int, followLinks bool) error {
 	if b.euid != 0 && b.egid != 0 {
-		return os.ErrPermission
+		return ErrNotPermitted
 	}
 
 	f, err := b.getFileInfo(name, followLinks)
@@ -287,43 +480,37 @@ func (b *Billy) changeOwnership(name string, uid, gid int, followLinks bool) err
 		if !ok {
 			return os.ErrInvalid
 		}
-		fdir.Tree.uid = uint32(uid)
-		fdir.Tree.gid = uint32(gid)
-		return nil
+		return fdir.Tree.setOwner(uint32(uid), uint32(gid))
 	}
-	ffile.uid = uint32(uid)
-	ffile.gid = uint32(gid)
-
-	return nil
+	return ffile.setOwner(uint32(uid), uint32(gid))
 }
 
-// Chtimes changes file access time
+// Chtimes changes file access and modification times
 func (b *Billy) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	f, err := b.getFileInfo(name, true)
 	if err != nil {
-		return err
+		return pathError("chtimes", name, err)
 	}
 	ffile, ok := f.(*File)
 	if !ok {
-		fdir, ok := f.(*DirMeta)
-		if !ok {
-			return os.ErrInvalid
-		}
-		fdir.Tree.modTime = mtime
+		fdir := f.(*DirMeta)
+		fdir.Tree.setTimes(atime, mtime)
+		fdir.Tree.changed(OpChmod)
 		return nil
 	}
-	ffile.modTime = mtime
+	ffile.setTimes(atime, mtime)
+	ffile.changed(OpChmod)
 
 	return nil
 }
 
 // Chroot returns a subtree of the filesystem
 func (b *Billy) Chroot(path string) (billy.Filesystem, error) {
-	dir := b.root.WalkDir(strings.Split(path, Separator))
-	if dir == nil {
-		return nil, os.ErrNotExist
+	dir, err := b.dir(path)
+	if err != nil {
+		return nil, pathError("chroot", path, err)
 	}
-	return &Billy{b.euid, b.egid, dir}, nil
+	return &Billy{euid: b.euid, egid: b.egid, umask: b.umask, root: dir}, nil
 }
 
 // Root prints the path of the current fs root
@@ -2,54 +2,111 @@ package memphis
 
 import (
 	"io"
+	"os"
 
 	"github.com/go-git/go-billy/v5"
 )
 
-// BillyFile is a wrapper to file contents implementing the implicit position cursor for read/write
+// BillyFile is a handle to an open file, tracking the flags it was opened with and the
+// implicit position cursor for read/write
 type BillyFile struct {
 	*File
 	position int64
+	flag     int
+	closed   bool
 }
 
 var _ billy.File = (*BillyFile)(nil)
 
-// Lock is not used in this implementation
-func (bf *BillyFile) Lock() error {
+// openHandle creates a handle to f, which stays readable until closed even if it is removed.
+func openHandle(f *File, flag int) *BillyFile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opens++
+	return &BillyFile{File: f, flag: flag}
+}
+
+// check validates the handle is open with an access mode permitting reads or writes
+func (bf *BillyFile) check(write bool) error {
+	if bf.closed {
+		return os.ErrClosed
+	}
+	switch bf.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		if write {
+			return ErrBadHandle
+		}
+	case os.O_WRONLY:
+		if !write {
+			return ErrBadHandle
+		}
+	}
 	return nil
 }
 
-// Unlock is not used in this implementation
+// Lock takes an exclusive advisory lock on the file, waiting for other holders to release it
+func (bf *BillyFile) Lock() error {
+	if bf.closed {
+		return pathError("flock", bf.Name(), os.ErrClosed)
+	}
+	return bf.Flock(LockExclusive)
+}
+
+// Unlock releases the advisory lock taken by Lock
 func (bf *BillyFile) Unlock() error {
-	return nil
+	if bf.closed {
+		return pathError("flock", bf.Name(), os.ErrClosed)
+	}
+	return bf.Flock(LockUnlock)
 }
 
 // Truncate changes the size of the file contents
 func (bf *BillyFile) Truncate(size int64) error {
-	if size == 0 {
-		bf.contents = NewEmptyFileContents()
-		return nil
+	if err := bf.check(true); err != nil {
+		return pathError("truncate", bf.Name(), err)
 	}
-
-	var truncatable TruncatableContents
-	var ok bool
-	if truncatable, ok = bf.contents.(TruncatableContents); !ok {
-		bf.contents = MemBufferFrom(bf.contents)
-		truncatable = bf.contents.(TruncatableContents)
+	bf.mu.Lock()
+	err := bf.truncate(size)
+	bf.mu.Unlock()
+	if err != nil {
+		return pathError("truncate", bf.Name(), err)
 	}
-	truncatable.Truncate(size)
-
+	bf.changed(OpWrite)
 	return nil
 }
 
-// Close closes the file - not relevant in this implementation.
+// Close closes the handle, releasing any locks held through it. Once the last
+// handle to a removed file is closed its contents are freed.
 func (bf *BillyFile) Close() error {
+	if bf.closed {
+		return pathError("close", bf.Name(), os.ErrClosed)
+	}
+	bf.closed = true
+	bf.File.locks().releaseAll(bf.File, bf)
+
+	bf.mu.Lock()
+	bf.opens--
+	free := bf.opens == 0 && bf.unlinked
+	bf.mu.Unlock()
+	if free {
+		bf.File.free()
+	}
 	return nil
 }
 
 // ReadAt is a passthrough.
 func (bf *BillyFile) ReadAt(buf []byte, offset int64) (n int, err error) {
-	return bf.contents.ReadAt(buf, offset)
+	if err := bf.check(false); err != nil {
+		return 0, pathError("read", bf.Name(), err)
+	}
+	bf.mu.Lock()
+	bf.accessed(bf.vol.atimePolicy(), bf.vol.now())
+	bf.mu.Unlock()
+	n, err = bf.contents.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		err = pathError("read", bf.Name(), err)
+	}
+	return
 }
 
 // Read is a more common implementation implemented by ReadAt
@@ -59,32 +116,64 @@ func (bf *BillyFile) Read(buf []byte) (n int, err error) {
 	return
 }
 
-// Write modifies file contents
+// Write modifies file contents. Handles opened with O_APPEND always write at
+// the end of the file.
 func (bf *BillyFile) Write(buf []byte) (n int, err error) {
+	if err := bf.check(true); err != nil {
+		return 0, pathError("write", bf.Name(), err)
+	}
+	bf.mu.Lock()
+	if bf.flag&os.O_APPEND != 0 {
+		bf.position = bf.contents.Size()
+	}
 	n, err = bf.contents.WriteAt(buf, bf.position)
+	bf.mu.Unlock()
 	bf.position += int64(n)
-	return
+	if n > 0 {
+		bf.changed(OpWrite)
+	}
+	return n, pathError("write", bf.Name(), err)
 }
 
 // WriteAt is a passthrough.
 func (bf *BillyFile) WriteAt(buf []byte, offset int64) (n int, err error) {
-	return bf.contents.WriteAt(buf, offset)
+	if err := bf.check(true); err != nil {
+		return 0, pathError("write", bf.Name(), err)
+	}
+	if bf.flag&os.O_APPEND != 0 {
+		// as os.File, positional writes are not meaningful on append-only handles
+		return 0, pathError("write", bf.Name(), ErrBadHandle)
+	}
+	bf.mu.Lock()
+	n, err = bf.contents.WriteAt(buf, offset)
+	bf.mu.Unlock()
+	if n > 0 {
+		bf.changed(OpWrite)
+	}
+	return n, pathError("write", bf.Name(), err)
 }
 
 // Seek changes file position
 func (bf *BillyFile) Seek(offset int64, whence int) (int64, error) {
+	if bf.closed {
+		return 0, pathError("seek", bf.Name(), os.ErrClosed)
+	}
+	pos := bf.position
 	switch whence {
 	case io.SeekCurrent:
-		bf.position += offset
+		pos += offset
 	case io.SeekStart:
-		bf.position = offset
+		pos = offset
 	case io.SeekEnd:
-		bf.position = bf.contents.Size() - offset
+		pos = bf.contents.Size() + offset
+	default:
+		return 0, pathError("seek", bf.Name(), os.ErrInvalid)
 	}
 	// validate
-	if bf.position < 0 {
-		return -1, io.EOF
+	if pos < 0 {
+		return 0, pathError("seek", bf.Name(), os.ErrInvalid)
 	}
+	bf.position = pos
 
 	return bf.position, nil
 }
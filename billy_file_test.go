@@ -0,0 +1,73 @@
+package memphis
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBillyFileFlags(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+
+	f, err := b.OpenFile("f", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("more")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, ErrBadHandle) {
+		t.Errorf("read from a write-only handle = %v, want ErrBadHandle", err)
+	}
+	if _, err := f.(*BillyFile).WriteAt([]byte("x"), 0); !errors.Is(err, ErrBadHandle) {
+		t.Errorf("positional write to an append handle = %v, want ErrBadHandle", err)
+	}
+	f.Close()
+	if got := string(root.entry("f").file.Bytes()); got != "datamore" {
+		t.Errorf("contents after appending = %q", got)
+	}
+
+	r, err := b.Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Write([]byte("x")); !errors.Is(err, ErrBadHandle) {
+		t.Errorf("write to a read-only handle = %v, want ErrBadHandle", err)
+	}
+	if err := r.Truncate(0); !errors.Is(err, ErrBadHandle) {
+		t.Errorf("truncate of a read-only handle = %v, want ErrBadHandle", err)
+	}
+}
+
+func TestBillyFileClose(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	f, err := b.Open("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Remove("f"); err != nil {
+		t.Fatal(err)
+	}
+	// an open handle keeps a removed file readable
+	if got, err := io.ReadAll(f); err != nil || string(got) != "data" {
+		t.Errorf("read of a removed file = %q, %v", got, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("second Close = %v, want ErrClosed", err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("read after Close = %v, want ErrClosed", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("seek after Close = %v, want ErrClosed", err)
+	}
+}
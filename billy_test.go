@@ -0,0 +1,69 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOpenFileCreate(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	if err := b.Symlink("target", "dangling"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := b.OpenFile("dangling", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if root.entry("target").file == nil {
+		t.Error("O_CREATE through a dangling symlink did not create its target")
+	}
+
+	f, err = b.OpenFile("f", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got := root.entry("f").file.Size(); got != 0 {
+		t.Errorf("O_TRUNC left %d bytes", got)
+	}
+}
+
+func TestOpenFileErrors(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	if _, err := root.CreateDir("d", 0, 0, 0755|os.ModeDir); err != nil {
+		t.Fatal(err)
+	}
+	b := root.AsBillyFS(0, 0)
+	b.Symlink("missing", "dangling")
+
+	for _, c := range []struct {
+		name string
+		flag int
+		want error
+	}{
+		{"f", os.O_RDWR | os.O_CREATE | os.O_EXCL, os.ErrExist},
+		{"dangling", os.O_RDWR | os.O_CREATE | os.O_EXCL, os.ErrExist},
+		{"absent", os.O_RDONLY, os.ErrNotExist},
+		{"d", os.O_RDONLY, ErrIsDir},
+		{"new/", os.O_RDWR | os.O_CREATE, ErrIsDir},
+	} {
+		if _, err := b.OpenFile(c.name, c.flag, 0644); !errors.Is(err, c.want) {
+			t.Errorf("OpenFile(%q, %#x) = %v, want %v", c.name, c.flag, err, c.want)
+		}
+	}
+	if root.entry("missing").exists() {
+		t.Error("exclusive creation followed a dangling symlink")
+	}
+	if _, err := root.AsBillyFS(1, 1).OpenFile("f", os.O_RDWR|os.O_TRUNC, 0); !os.IsPermission(err) {
+		t.Errorf("O_TRUNC without write permission = %v, want ErrPermission", err)
+	}
+	if got := root.entry("f").file.Size(); got != 4 {
+		t.Errorf("a refused open truncated the file to %d bytes", got)
+	}
+}
@@ -0,0 +1,91 @@
+package memphis
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock provides the time used for timestamps assigned by a tree
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// RealClock reads the system time
+func RealClock() Clock {
+	return realClock{}
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// FixedClock always reports the same time
+func FixedClock(t time.Time) Clock {
+	return fixedClock(t)
+}
+
+type stepClock struct {
+	sync.Mutex
+	next time.Time
+	step time.Duration
+}
+
+func (c *stepClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	t := c.next
+	c.next = c.next.Add(c.step)
+	return t
+}
+
+// StepClock reports start the first time it is read, and advances by step on every read after,
+// so each timestamp is distinct and predictable.
+func StepClock(start time.Time, step time.Duration) Clock {
+	return &stepClock{next: start, step: step}
+}
+
+// SourceDateEpochClock reports the time set by the SOURCE_DATE_EPOCH environment
+// variable, as used for reproducible builds. It fails if the variable is unset or invalid.
+func SourceDateEpochClock() (Clock, error) {
+	epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	secs, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return FixedClock(time.Unix(secs, 0).UTC()), nil
+}
+
+// SetClock sets the clock used for timestamps in the tree this directory belongs to.
+// A nil clock restores the real clock.
+func (t *Tree) SetClock(c Clock) {
+	if c == nil {
+		c = RealClock()
+	}
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.clock = c
+}
+
+// now reads the clock of the volume
+func (v *volume) now() time.Time {
+	if v == nil {
+		return time.Now()
+	}
+	v.Lock()
+	c := v.clock
+	v.Unlock()
+	return c.Now()
+}
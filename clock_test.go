@@ -0,0 +1,45 @@
+package memphis
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	c := StepClock(testEpoch, time.Minute)
+	if first, second := c.Now(), c.Now(); !first.Equal(testEpoch) || second.Sub(first) != time.Minute {
+		t.Errorf("StepClock read %v then %v", first, second)
+	}
+
+	root := New()
+	root.SetClock(FixedClock(testEpoch))
+	f := mustWrite(t, root, "f", "data")
+	if !f.modTime.Equal(testEpoch) || !f.createTime.Equal(testEpoch) {
+		t.Errorf("file created at %v, modified at %v under a fixed clock", f.createTime, f.modTime)
+	}
+	root.SetClock(nil)
+	if now := root.vol.now(); now.Sub(time.Now()) > time.Minute || time.Since(now) > time.Minute {
+		t.Errorf("a nil clock reads %v, want the real time", now)
+	}
+}
+
+func TestSourceDateEpochClock(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1577836800")
+	c, err := SourceDateEpochClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Now(); !got.Equal(testEpoch) {
+		t.Errorf("SOURCE_DATE_EPOCH clock reads %v, want %v", got, testEpoch)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "soon")
+	if _, err := SourceDateEpochClock(); err == nil {
+		t.Error("an invalid SOURCE_DATE_EPOCH was accepted")
+	}
+	os.Unsetenv("SOURCE_DATE_EPOCH")
+	if _, err := SourceDateEpochClock(); !os.IsNotExist(err) {
+		t.Errorf("SourceDateEpochClock without the variable = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,78 @@
+package memphis
+
+// Consistency is the policy a FromOS tree applies when files change on disk after they were imported.
+type Consistency int
+
+const (
+	// ConsistencyLive follows changes to the file on disk, including its size.
+	// Once a file has been modified in memphis its size is no longer updated.
+	// It is the default, as FromOS trees have always read what is on disk.
+	ConsistencyLive Consistency = iota
+	// ConsistencyError fails reads of a file that no longer matches the inode, size
+	// and modification time seen when it was imported.
+	ConsistencyError
+	// ConsistencySnapshot checks the file matches its imported version when it is
+	// first read, and then keeps that descriptor open so later reads see the same
+	// file even if the path is replaced or removed. Pinned descriptors count against
+	// the descriptor cache size; once it is full the oldest are closed, and those
+	// files are checked against the disk as with ConsistencyError.
+	ConsistencySnapshot
+)
+
+// SetConsistency sets how the tree this directory belongs to handles changes to files on disk.
+// Changes are noticed within a second of being made.
+func (t *Tree) SetConsistency(c Consistency) {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.policy = c
+}
+
+func (v *volume) consistency() Consistency {
+	v.Lock()
+	defer v.Unlock()
+	return v.policy
+}
+
+// open acquires a descriptor for the file according to the consistency policy.
+// The descriptor must be returned with release.
+func (o *osFileContent) open() (*cachedFD, error) {
+	o.Lock()
+	defer o.Unlock()
+	fds := o.vol.fds
+	if o.pin != nil {
+		if fds.retainPinned(o.pin) {
+			return o.pin, nil
+		}
+		// the cache closed the snapshot to stay within its bound
+		o.pin = nil
+	}
+
+	fd, err := fds.acquire(o.path)
+	if err != nil {
+		return nil, err
+	}
+	policy := o.vol.consistency()
+	if !sameVersion(fd.info, o.info) {
+		if policy != ConsistencyLive {
+			fds.release(fd)
+			return nil, ErrStale
+		}
+		o.info = fd.info
+		o.size = fd.info.Size()
+	}
+	if policy == ConsistencySnapshot && fds.pin(fd) {
+		o.pin = fd
+	}
+	return fd, nil
+}
+
+// unpin releases a descriptor held open for a snapshot
+func (o *osFileContent) unpin() {
+	o.Lock()
+	defer o.Unlock()
+	if o.pin == nil {
+		return
+	}
+	o.vol.fds.unpin(o.pin)
+	o.pin = nil
+}
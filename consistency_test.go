@@ -0,0 +1,134 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// importFile writes a file to a temporary directory and imports the directory
+func importFile(t *testing.T, data string) (*Tree, *File, string) {
+	t.Helper()
+	dir := t.TempDir()
+	p := filepath.Join(dir, "f")
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := FromOS(dir)
+	f, _, err := root.Get([]string{"f"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, f, p
+}
+
+func TestConsistencyLiveByDefault(t *testing.T) {
+	root, f, p := importFile(t, "old")
+	root.SetDescriptorCache(0)
+	os.WriteFile(p, []byte("newer"), 0644)
+	if got := string(f.Bytes()); got != "newer" {
+		t.Errorf("read %q after the file changed on disk, want %q", got, "newer")
+	}
+}
+
+func TestConsistencyError(t *testing.T) {
+	root, f, p := importFile(t, "old")
+	root.SetDescriptorCache(0)
+	root.SetConsistency(ConsistencyError)
+	if got := string(f.Bytes()); got != "old" {
+		t.Fatalf("read %q, want %q", got, "old")
+	}
+	os.WriteFile(p, []byte("newer"), 0644)
+	if _, err := f.contents.ReadAt(make([]byte, 3), 0); !errors.Is(err, ErrStale) {
+		t.Errorf("read after the file changed = %v, want ErrStale", err)
+	}
+}
+
+func TestConsistencySnapshot(t *testing.T) {
+	root, f, p := importFile(t, "old")
+	root.SetConsistency(ConsistencySnapshot)
+	if got := string(f.Bytes()); got != "old" {
+		t.Fatalf("read %q, want %q", got, "old")
+	}
+	// replace the file, as an editor saving it would
+	tmp := p + ".tmp"
+	os.WriteFile(tmp, []byte("new"), 0644)
+	os.Rename(tmp, p)
+	if got := string(f.Bytes()); got != "old" {
+		t.Errorf("snapshot read %q after the file was replaced, want %q", got, "old")
+	}
+}
+
+func TestConsistencySnapshotBounded(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"a", "b", "c", "d"} {
+		os.WriteFile(filepath.Join(dir, n), []byte(n), 0644)
+	}
+	root := FromOS(dir)
+	root.SetConsistency(ConsistencySnapshot)
+	root.SetDescriptorCache(2)
+	for _, n := range root.Names() {
+		if got := string(root.files[n].Bytes()); got != n {
+			t.Errorf("read %q from %s", got, n)
+		}
+	}
+	fds := root.vol.fds
+	if open := fds.lru.Len() + fds.pins.Len(); open > 2 {
+		t.Errorf("%d descriptors held open, want at most 2", open)
+	}
+	if err := root.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fds.pins.Len() != 0 {
+		t.Error("Close left descriptors pinned")
+	}
+}
+
+func TestRefreshSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "l")
+	os.Symlink("a", link)
+	root := FromOS(dir)
+	root.Names()
+
+	os.Remove(link)
+	os.Symlink("bb", link)
+	if err := root.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(root.files["l"].Bytes()); got != "bb" {
+		t.Errorf("refreshed symlink points to %q, want %q", got, "bb")
+	}
+
+	os.Remove(link)
+	if err := root.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if root.entry("l").exists() {
+		t.Error("symlink removed from disk was kept")
+	}
+}
+
+func TestRefreshUsesClock(t *testing.T) {
+	dir := t.TempDir()
+	root := FromOS(dir)
+	root.Names()
+	now := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	root.SetClock(FixedClock(now))
+
+	if err := root.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if root.modTime.Equal(now) {
+		t.Error("Refresh without changes updated the directory times")
+	}
+	os.WriteFile(filepath.Join(dir, "new"), nil, 0644)
+	if err := root.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if !root.modTime.Equal(now) || !root.changeTime.Equal(now) {
+		t.Errorf("Refresh set times %v, %v, want %v", root.modTime, root.changeTime, now)
+	}
+}
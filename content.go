@@ -18,8 +18,16 @@ type TruncatableContents interface {
 	Truncate(size int64) error
 }
 
+// accountant is charged for growth of in-memory contents so that limits can be enforced
+type accountant interface {
+	charge(delta int64) error
+}
+
 type memoryContents struct {
 	bytes []byte
+	acct  accountant
+	vol   *volume
+	spill *spillFile
 }
 
 // NewEmptyFileContents creates a new memoryContents buffer
@@ -29,6 +37,9 @@ func NewEmptyFileContents() FileContent {
 }
 
 func (m *memoryContents) Size() int64 {
+	if m.spill != nil {
+		return m.spill.size
+	}
 	return int64(len(m.bytes))
 }
 
@@ -36,8 +47,21 @@ func (m *memoryContents) WriteAt(p []byte, offset int64) (int, error) {
 	if offset < 0 {
 		return 0, os.ErrInvalid
 	}
+	if m.spill == nil && m.shouldSpill(offset+int64(len(p))) {
+		if err := m.spillOut(); err != nil {
+			return 0, err
+		}
+	}
+	if m.spill != nil {
+		return m.spill.WriteAt(p, offset)
+	}
 
 	prev := len(m.bytes)
+	if end := offset + int64(len(p)); end > int64(prev) {
+		if err := m.account(end - int64(prev)); err != nil {
+			return 0, err
+		}
+	}
 
 	padding := int(offset) - prev
 	if padding > 0 {
@@ -56,6 +80,9 @@ func (m *memoryContents) ReadAt(buf []byte, offset int64) (n int, err error) {
 	if offset < 0 {
 		return 0, os.ErrInvalid
 	}
+	if m.spill != nil {
+		return m.spill.ReadAt(buf, offset)
+	}
 
 	size := int64(len(m.bytes))
 	if offset >= size {
@@ -77,9 +104,23 @@ func (m *memoryContents) ReadAt(buf []byte, offset int64) (n int, err error) {
 }
 
 func (m *memoryContents) Truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if m.spill == nil && m.shouldSpill(size) {
+		if err := m.spillOut(); err != nil {
+			return err
+		}
+	}
+	if m.spill != nil {
+		return m.spill.Truncate(size)
+	}
 	if int(size) == len(m.bytes) {
 		return nil
 	}
+	if err := m.account(size - int64(len(m.bytes))); err != nil {
+		return err
+	}
 	if int(size) < len(m.bytes) {
 		m.bytes = m.bytes[0:size]
 	}
@@ -91,6 +132,24 @@ func (m *memoryContents) Truncate(size int64) error {
 	return nil
 }
 
+func (m *memoryContents) account(delta int64) error {
+	if m.acct == nil {
+		return nil
+	}
+	return m.acct.charge(delta)
+}
+
+// residentBytes is the amount of memory held by file contents
+func residentBytes(fc FileContent) int64 {
+	switch c := fc.(type) {
+	case *memoryContents:
+		return int64(len(c.bytes))
+	case *overlayContents:
+		return c.resident()
+	}
+	return 0
+}
+
 // MemBufferFrom copies a file contents into a memoryContents format where it can be truncated
 func MemBufferFrom(fc FileContent) FileContent {
 	d := make([]byte, fc.Size())
@@ -102,33 +161,67 @@ func MemBufferFrom(fc FileContent) FileContent {
 			break
 		}
 	}
-	return &memoryContents{d}
+	return &memoryContents{bytes: d}
 }
 
-// copyOnWrite represents a FileContent that should on the first 'write' be copied via 'MemBufferFrom'
-type copyOnWrite struct {
-	FileContent
-	sync.Once
-}
+// memBufferCharged copies file contents into memory owned by f, charging it for the copy.
+// Contents large enough to spill are streamed straight to disk instead, and only
+// release what fc held in memory.
+func memBufferCharged(fc FileContent, f *File) (FileContent, error) {
+	m := &memoryContents{bytes: []byte{}}
+	if f != nil {
+		m.acct = f
+		m.vol = f.vol
+	}
+	if m.shouldSpill(fc.Size()) {
+		if err := m.spillOut(); err != nil {
+			return nil, err
+		}
+		if err := m.spill.copyFrom(fc); err != nil {
+			m.vol.discard(m.spill)
+			return nil, err
+		}
+		f.charge(-residentBytes(fc))
+		return m, nil
+	}
 
-func (c *copyOnWrite) WriteAt(p []byte, offset int64) (int, error) {
-	c.Do(func() {
-		c.FileContent = MemBufferFrom(c.FileContent)
-	})
-	return c.FileContent.WriteAt(p, offset)
+	if err := f.charge(fc.Size() - residentBytes(fc)); err != nil {
+		return nil, err
+	}
+	m.bytes = MemBufferFrom(fc).(*memoryContents).bytes
+	return m, nil
 }
 
 // osFileContent is a File Content backed by an on-disk file.
 type osFileContent struct {
+	sync.Mutex
 	path string
 	size int64
+	info os.FileInfo // info is the version of the file that was imported
+	vol  *volume
+	pin  *cachedFD
 }
 
 func (o *osFileContent) Size() int64 {
+	if o.vol != nil && o.vol.consistency() == ConsistencyLive {
+		if fd, err := o.open(); err == nil {
+			o.vol.fds.release(fd)
+		}
+	}
+	o.Lock()
+	defer o.Unlock()
 	return o.size
 }
 
 func (o *osFileContent) ReadAt(buf []byte, offset int64) (n int, err error) {
+	if o.vol != nil {
+		fd, err := o.open()
+		if err != nil {
+			return 0, err
+		}
+		defer o.vol.fds.release(fd)
+		return fd.readAt(buf, offset)
+	}
 	fp, err := os.Open(o.path)
 	if err != nil {
 		return 0, err
@@ -143,5 +236,8 @@ func (o *osFileContent) WriteAt(p []byte, offset int64) (int, error) {
 		return 0, err
 	}
 	defer fp.Close()
+	if o.vol != nil {
+		defer o.vol.fds.invalidate(o.path)
+	}
 	return fp.WriteAt(p, offset)
 }
@@ -0,0 +1,206 @@
+package memphis
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+)
+
+// CopyOptions configures copies of directory trees
+type CopyOptions struct {
+	// Progress, if set, is called after each entry is copied
+	Progress func(CopyProgress)
+}
+
+// CopyProgress reports how far a copy has got
+type CopyProgress struct {
+	Path    string // Path is the destination of the entry most recently copied
+	Entries int    // Entries counts the files and directories copied so far
+	Bytes   int64  // Bytes counts the file contents copied so far
+}
+
+// copier tracks the state of a copy across a tree
+type copier struct {
+	ctx      context.Context
+	opts     CopyOptions
+	progress CopyProgress
+}
+
+func newCopier(ctx context.Context, opts CopyOptions) *copier {
+	return &copier{ctx: ctx, opts: opts}
+}
+
+// copied records an entry as copied, and checks if the copy has been cancelled
+func (c *copier) copied(p string, bytes int64) error {
+	c.progress.Path = p
+	c.progress.Entries++
+	c.progress.Bytes += bytes
+	if c.opts.Progress != nil {
+		c.opts.Progress(c.progress)
+	}
+	return c.ctx.Err()
+}
+
+// copyBuffer is how much of a file is copied at a time
+const copyBuffer = 32 * 1024
+
+// reader wraps r so reading it fails once the copy is cancelled, stopping
+// large files from being copied to the end after the context is done
+func (c *copier) reader(r io.Reader) io.Reader {
+	return &ctxReader{c.ctx, r}
+}
+
+// ctxReader checks a context before each read
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// fill copies the contents of r into a new file, accounting them to it
+func (f *File) fill(r io.Reader) (int64, error) {
+	buf := make([]byte, copyBuffer)
+	n := int64(0)
+	for {
+		a, err := r.Read(buf)
+		if a > 0 {
+			if _, werr := f.contents.WriteAt(buf[:a], n); werr != nil {
+				return n, werr
+			}
+			n += int64(a)
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// RemoveAll removes the entry at a path relative to the directory, along with
+// everything beneath it, as os.RemoveAll. It is not an error for the path not to exist.
+func (t *Tree) RemoveAll(p string) error {
+	r, err := t.lookup(t, p, ResolveNoFollow)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return pathError("removeall", p, err)
+	}
+	if !r.exists() {
+		return nil
+	}
+	if r.parent == nil || r.dir == t {
+		return pathError("removeall", p, os.ErrInvalid)
+	}
+	r.parent.removeEntry(r.name)
+	return nil
+}
+
+// removeEntry unlinks and releases the entry under name
+func (t *Tree) removeEntry(name string) {
+	e := t.entry(name)
+	t.detach(name)
+	e.release()
+	t.entriesChanged()
+	t.notify(OpRemove, name)
+}
+
+// CopyTree copies the entry at src to dst, both relative to the directory. Directories are
+// copied recursively, and modes, ownership, times, extended attributes and ACLs are
+// preserved. Symlinks are copied as symlinks, and device and fifo nodes as nodes.
+// Since memphis has no hard links, there are none to preserve. dst must not exist.
+// The copy stops with the context's error if it is cancelled.
+func (t *Tree) CopyTree(ctx context.Context, src, dst string, opts CopyOptions) error {
+	s, err := t.lookup(t, src, ResolveNoFollow)
+	if err != nil {
+		return pathError("copy", src, err)
+	}
+	if !s.exists() {
+		return pathError("copy", src, os.ErrNotExist)
+	}
+	d, err := t.lookup(t, dst, ResolveNoFollow)
+	if err != nil {
+		return pathError("copy", dst, err)
+	}
+	if d.exists() || d.parent == nil {
+		return pathError("copy", dst, os.ErrExist)
+	}
+	if s.dir != nil && d.parent.within(s.dir) {
+		return linkError("copy", src, dst, os.ErrInvalid)
+	}
+
+	c := newCopier(ctx, opts)
+	if s.file != nil {
+		err = c.copyFile(s.file, d.parent, d.name, path.Clean(dst))
+	} else {
+		err = c.copyDir(s.dir, d.parent, d.name, path.Clean(dst))
+	}
+	return pathError("copy", dst, err)
+}
+
+func (c *copier) copyFile(f *File, parent *Tree, name, p string) error {
+	nf, err := parent.Create(name, f.uid, f.gid, f.mode)
+	if err != nil {
+		return pathError("copy", p, err)
+	}
+	n, err := nf.fill(c.reader(io.NewSectionReader(f.contents, 0, f.Size())))
+	if err != nil {
+		return pathError("copy", p, err)
+	}
+	nf.copyMeta(&f.inode)
+	return c.copied(p, n)
+}
+
+func (c *copier) copyDir(d *Tree, parent *Tree, name, p string) error {
+	d.ready.Do(d.deferred)
+	nd, err := parent.CreateDir(name, d.uid, d.gid, d.mode)
+	if err != nil {
+		return pathError("copy", p, err)
+	}
+	nd.defaultACL = d.defaultACL.copy()
+	if err := c.copied(p, 0); err != nil {
+		return err
+	}
+	for _, n := range d.Names() {
+		var err error
+		if e := d.entry(n); e.dir != nil {
+			err = c.copyDir(e.dir, nd, n, p+Separator+n)
+		} else {
+			err = c.copyFile(e.file, nd, n, p+Separator+n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	nd.copyMeta(&d.inode)
+	return nil
+}
+
+// copyMeta takes on the mode, times, extended attributes and ACL of another node
+func (n *inode) copyMeta(src *inode) {
+	n.accessTime = src.accessTime
+	n.modTime = src.modTime
+	n.copyAttrs(src)
+}
+
+// copyAttrs takes on the mode, extended attributes and ACL of another node
+func (n *inode) copyAttrs(src *inode) {
+	n.mode = src.mode
+	n.acl = src.acl.copy()
+	n.xattrs = nil
+	if src.xattrs != nil {
+		n.xattrs = make(xattrSet, len(src.xattrs))
+		for k, v := range src.xattrs {
+			n.xattrs[k] = append([]byte{}, v...)
+		}
+	}
+}
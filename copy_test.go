@@ -0,0 +1,83 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	root := New()
+	src, err := root.CreateDir("src", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, src, "file", "data")
+	if err := root.CopyTree(context.Background(), "src", "dst", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dst := root.entry("dst").dir
+	if dst == nil {
+		t.Fatal("dst was not copied as a directory")
+	}
+	if f := dst.entry("file").file; f == nil || string(f.Bytes()) != "data" {
+		t.Errorf("copied file = %v", f)
+	}
+}
+
+func TestCopyTreeErrors(t *testing.T) {
+	root := New()
+	if _, err := root.CreateDir("src", 0, 0, 0755|os.ModeDir); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, root, "exists", "data")
+	ctx := context.Background()
+
+	var pe *os.PathError
+	err := root.CopyTree(ctx, "missing", "dst", CopyOptions{})
+	if !errors.As(err, &pe) || pe.Path != "missing" || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("CopyTree of a missing source = %v", err)
+	}
+	err = root.CopyTree(ctx, "src", "exists", CopyOptions{})
+	if !errors.As(err, &pe) || pe.Path != "exists" || !errors.Is(err, os.ErrExist) {
+		t.Errorf("CopyTree onto an existing entry = %v", err)
+	}
+	var le *os.LinkError
+	err = root.CopyTree(ctx, "src", "src/inside", CopyOptions{})
+	if !errors.As(err, &le) || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("CopyTree into itself = %v", err)
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	root := New()
+	d, err := root.CreateDir("d", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "f", "data")
+	if err := root.RemoveAll("d"); err != nil {
+		t.Fatal(err)
+	}
+	if root.entry("d").exists() {
+		t.Error("RemoveAll left the directory")
+	}
+	if err := root.RemoveAll("d/missing"); err != nil {
+		t.Errorf("RemoveAll of a missing path = %v", err)
+	}
+	if err := root.RemoveAll("."); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("RemoveAll of the directory itself = %v, want EINVAL", err)
+	}
+}
+
+func TestCopyTreeCancelled(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := root.CopyTree(ctx, "f", "g", CopyOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CopyTree with a cancelled context = %v", err)
+	}
+}
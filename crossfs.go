@@ -0,0 +1,287 @@
+package memphis
+
+import (
+	"context"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+)
+
+// ReadLinkFS is an optional fs.FS interface for reading symlinks.
+// Without it, symlinks found by ImportFS are copied as empty links.
+type ReadLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// copySource abstracts a foreign filesystem being copied into a tree
+type copySource interface {
+	stat(name string) (os.FileInfo, error)
+	readDir(name string) ([]os.FileInfo, error)
+	readLink(name string) (string, error)
+	open(name string) (io.ReadCloser, error)
+	join(elem ...string) string
+}
+
+type fsSource struct {
+	fsys iofs.FS
+}
+
+// stat describes name without following a final symlink. fs.FS has no lstat, so the
+// entry is looked up in the listing of its parent, whose entries are not followed.
+func (s fsSource) stat(name string) (os.FileInfo, error) {
+	if name == "." {
+		return iofs.Stat(s.fsys, name)
+	}
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "lstat", Path: name, Err: iofs.ErrInvalid}
+	}
+	entries, err := iofs.ReadDir(s.fsys, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	base := path.Base(name)
+	for _, e := range entries {
+		if e.Name() == base {
+			return e.Info()
+		}
+	}
+	return nil, &iofs.PathError{Op: "lstat", Path: name, Err: iofs.ErrNotExist}
+}
+
+func (s fsSource) readDir(name string) ([]os.FileInfo, error) {
+	entries, err := iofs.ReadDir(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s fsSource) readLink(name string) (string, error) {
+	if rl, ok := s.fsys.(ReadLinkFS); ok {
+		return rl.ReadLink(name)
+	}
+	return "", nil
+}
+
+func (s fsSource) open(name string) (io.ReadCloser, error) {
+	return s.fsys.Open(name)
+}
+
+func (s fsSource) join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+type billySource struct {
+	fs billy.Filesystem
+}
+
+func (s billySource) stat(name string) (os.FileInfo, error) {
+	return s.fs.Lstat(name)
+}
+
+func (s billySource) readDir(name string) ([]os.FileInfo, error) {
+	return s.fs.ReadDir(name)
+}
+
+func (s billySource) readLink(name string) (string, error) {
+	return s.fs.Readlink(name)
+}
+
+func (s billySource) open(name string) (io.ReadCloser, error) {
+	return s.fs.Open(name)
+}
+
+func (s billySource) join(elem ...string) string {
+	return s.fs.Join(elem...)
+}
+
+// ImportFS copies the whole of fsys into a new directory at dst, relative to the directory.
+// Modes and modification times are preserved, and entries are owned by the owner of the
+// directory dst is created in. Special files are created without being opened.
+// Hard links are not preserved: memphis has none, so each link to a file is imported
+// as a separate copy of its contents.
+func (t *Tree) ImportFS(ctx context.Context, fsys iofs.FS, dst string, opts CopyOptions) error {
+	return t.importFrom(ctx, fsSource{fsys}, ".", dst, opts)
+}
+
+// ImportBilly copies srcPath of a billy filesystem to dst, relative to the directory, as ImportFS.
+func (t *Tree) ImportBilly(ctx context.Context, src billy.Filesystem, srcPath, dst string, opts CopyOptions) error {
+	return t.importFrom(ctx, billySource{src}, srcPath, dst, opts)
+}
+
+func (t *Tree) importFrom(ctx context.Context, src copySource, srcPath, dst string, opts CopyOptions) error {
+	info, err := src.stat(srcPath)
+	if err != nil {
+		return pathError("import", srcPath, err)
+	}
+	d, err := t.lookup(t, dst, ResolveNoFollow)
+	if err != nil {
+		return pathError("import", dst, err)
+	}
+	if d.exists() || d.parent == nil {
+		return pathError("import", dst, os.ErrExist)
+	}
+	c := newCopier(ctx, opts)
+	return pathError("import", dst, c.importEntry(src, srcPath, info, d.parent, d.name, path.Clean(dst)))
+}
+
+func (c *copier) importEntry(src copySource, name string, info os.FileInfo, parent *Tree, dstName, p string) error {
+	uid, gid := parent.uid, parent.gid
+	mtime := info.ModTime()
+
+	if info.IsDir() {
+		d, err := parent.CreateDir(dstName, uid, gid, info.Mode()|os.ModeDir)
+		if err != nil {
+			return pathError("import", p, err)
+		}
+		if err := c.copied(p, 0); err != nil {
+			return err
+		}
+		children, err := src.readDir(name)
+		if err != nil {
+			return pathError("import", name, err)
+		}
+		for _, child := range children {
+			if err := c.importEntry(src, src.join(name, child.Name()), child, d, child.Name(), p+Separator+child.Name()); err != nil {
+				return err
+			}
+		}
+		d.setTimes(mtime, mtime)
+		return nil
+	}
+
+	f, err := parent.Create(dstName, uid, gid, info.Mode())
+	if err != nil {
+		return pathError("import", p, err)
+	}
+	n := int64(0)
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := src.readLink(name)
+		if err != nil {
+			return pathError("import", name, err)
+		}
+		if n, err = f.fill(strings.NewReader(target)); err != nil {
+			return pathError("import", p, err)
+		}
+	case info.Mode().IsRegular():
+		r, err := src.open(name)
+		if err != nil {
+			return pathError("import", name, err)
+		}
+		n, err = f.fill(c.reader(r))
+		r.Close()
+		if err != nil {
+			return pathError("import", name, err)
+		}
+	}
+	f.setTimes(mtime, mtime)
+	return c.copied(p, n)
+}
+
+// ExportBilly copies src, relative to the directory, to dstPath of a billy filesystem,
+// which must not exist. When the filesystem supports billy.Change, modes, times and,
+// where permitted, ownership are preserved. Device and fifo nodes cannot be exported,
+// and fail with ErrNotSupported.
+func (t *Tree) ExportBilly(ctx context.Context, src string, dst billy.Filesystem, dstPath string, opts CopyOptions) error {
+	s, err := t.lookup(t, src, ResolveNoFollow)
+	if err != nil {
+		return pathError("export", src, err)
+	}
+	if !s.exists() {
+		return pathError("export", src, os.ErrNotExist)
+	}
+	if _, err := dst.Lstat(dstPath); err == nil {
+		return pathError("export", dstPath, os.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return pathError("export", dstPath, err)
+	}
+	c := newCopier(ctx, opts)
+	if s.file != nil {
+		return pathError("export", dstPath, c.exportFile(s.file, dst, dstPath))
+	}
+	return pathError("export", dstPath, c.exportDir(s.dir, dst, dstPath))
+}
+
+func (c *copier) exportFile(f *File, dst billy.Filesystem, p string) error {
+	n := int64(0)
+	switch {
+	case f.mode&os.ModeSymlink != 0:
+		if err := dst.Symlink(string(f.Bytes()), p); err != nil {
+			return pathError("export", p, err)
+		}
+	case f.mode.IsRegular():
+		out, err := dst.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, f.mode.Perm())
+		if err != nil {
+			return pathError("export", p, err)
+		}
+		buf := make([]byte, copyBuffer)
+		n, err = io.CopyBuffer(out, c.reader(io.NewSectionReader(f.contents, 0, f.Size())), buf)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return pathError("export", p, err)
+		}
+	default:
+		return pathError("export", p, ErrNotSupported)
+	}
+	if err := exportMeta(&f.inode, dst, p); err != nil {
+		return pathError("export", p, err)
+	}
+	return c.copied(p, n)
+}
+
+func (c *copier) exportDir(d *Tree, dst billy.Filesystem, p string) error {
+	d.ready.Do(d.deferred)
+	// the directory is writable while it is filled, and takes on its mode afterwards
+	if err := dst.MkdirAll(p, d.mode.Perm()|0700); err != nil {
+		return pathError("export", p, err)
+	}
+	if err := c.copied(p, 0); err != nil {
+		return err
+	}
+	for _, n := range d.Names() {
+		var err error
+		if e := d.entry(n); e.dir != nil {
+			err = c.exportDir(e.dir, dst, dst.Join(p, n))
+		} else {
+			err = c.exportFile(e.file, dst, dst.Join(p, n))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return pathError("export", p, exportMeta(&d.inode, dst, p))
+}
+
+// exportMeta applies the metadata of a node to a path of a billy filesystem. As cp -p,
+// ownership that cannot be set for lack of privilege is left as it is.
+func exportMeta(n *inode, dst billy.Filesystem, p string) error {
+	ch, ok := dst.(billy.Change)
+	if !ok {
+		return nil
+	}
+	if err := ch.Lchown(p, int(n.uid), int(n.gid)); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	if n.mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err := ch.Chmod(p, n.mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return ch.Chtimes(p, n.accessTime, n.modTime)
+}
@@ -0,0 +1,99 @@
+package memphis
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-git/go-billy/v5/memfs"
+)
+
+func TestImportFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/file": {Data: []byte("data"), Mode: 0644},
+		"link":     {Data: []byte("dir"), Mode: fs.ModeSymlink | 0777},
+	}
+	root := New()
+	if err := root.ImportFS(context.Background(), fsys, "in", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	in := root.entry("in").dir
+	if in == nil {
+		t.Fatal("ImportFS did not create a directory")
+	}
+	if f := in.entry("dir").dir.entry("file").file; f == nil || string(f.Bytes()) != "data" {
+		t.Errorf("imported file = %v", f)
+	}
+	// the symlink to a directory is imported as a link, not followed
+	link := in.entry("link")
+	if link.file == nil || link.file.mode&os.ModeSymlink == 0 {
+		t.Fatalf("imported link = %+v", link)
+	}
+	if info, err := (fsSource{fsys}).stat("link"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("stat of a symlink = %v, %v, want the link itself", info, err)
+	}
+	if _, err := (fsSource{fsys}).stat("dir/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat of a missing entry = %v", err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "exists", "data")
+	ctx := context.Background()
+
+	var pe *os.PathError
+	err := root.ImportFS(ctx, fstest.MapFS{}, "exists", CopyOptions{})
+	if !errors.As(err, &pe) || pe.Path != "exists" || !errors.Is(err, os.ErrExist) {
+		t.Errorf("ImportFS onto an existing entry = %v", err)
+	}
+	err = root.ImportBilly(ctx, memfs.New(), "missing", "dst", CopyOptions{})
+	if !errors.As(err, &pe) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ImportBilly of a missing source = %v", err)
+	}
+}
+
+func TestExportBilly(t *testing.T) {
+	root := New()
+	dir, err := root.CreateDir("dir", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, dir, "file", "data")
+	dst := memfs.New()
+	if err := root.ExportBilly(context.Background(), "dir", dst, "out", CopyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dst.Open("out/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 8)
+	if n, _ := f.Read(buf); string(buf[:n]) != "data" {
+		t.Errorf("exported file = %q", buf[:n])
+	}
+}
+
+func TestExportBillyErrors(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "file", "data")
+	dst := memfs.New()
+	if err := dst.MkdirAll("taken", 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var pe *os.PathError
+	err := root.ExportBilly(ctx, "missing", dst, "out", CopyOptions{})
+	if !errors.As(err, &pe) || pe.Path != "missing" || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ExportBilly of a missing source = %v", err)
+	}
+	err = root.ExportBilly(ctx, "file", dst, "taken", CopyOptions{})
+	if !errors.As(err, &pe) || pe.Path != "taken" || !errors.Is(err, os.ErrExist) {
+		t.Errorf("ExportBilly onto an existing path = %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 )
 
 func deferredOSDir(dir *Tree, dirPath string) func() {
+	dir.osPath = dirPath
 	return func() {
 		info, err := os.Stat(dirPath)
 		if err != nil {
@@ -14,11 +15,19 @@ func deferredOSDir(dir *Tree, dirPath string) func() {
 		}
 		dir.modTime = info.ModTime()
 		dir.createTime = dir.modTime
+		dir.accessTime = dir.modTime
+		dir.changeTime = dir.modTime
 
 		// hacky retreaval of uid/guid from os
+		uid := dir.uid
 		osStat(dir, info.Sys())
+		if uid != dir.uid {
+			dir.vol.add(uid, 0, -1)
+			dir.vol.add(dir.uid, 0, 1)
+		}
 
 		dir.mode = info.Mode()
+		xattrNodeOf(nil, dir).adopt(osXattrs(dirPath))
 
 		files, err := ioutil.ReadDir(dirPath)
 		if err != nil {
@@ -26,31 +35,162 @@ func deferredOSDir(dir *Tree, dirPath string) func() {
 		}
 
 		for _, f := range files {
-			if f.IsDir() {
-				child := newTree(dir.uid, dir.gid, dir.mode)
-				child.deferred = deferredOSDir(child, path.Join(dirPath, f.Name()))
-				dir.directories[f.Name()] = child
-			} else {
-				dir.files[f.Name()] = FileFromOS(path.Join(dirPath, f.Name()), dir.uid, dir.gid, f)
+			// entries that do not fit the tree's limits are left out
+			dir.importOS(f)
+		}
+	}
+}
+
+// importOS adds an entry of the directory's OS path to the tree
+func (t *Tree) importOS(f os.FileInfo) error {
+	p := path.Join(t.osPath, f.Name())
+	if f.IsDir() {
+		child := newTree(t.vol, t.uid, t.gid, t.mode)
+		child.parent = t
+		child.name = f.Name()
+		child.deferred = deferredOSDir(child, p)
+		t.directories[f.Name()] = child
+		t.indexAdd(f.Name())
+		t.vol.add(child.uid, 0, 1)
+		return nil
+	}
+	file := FileFromOS(p, t.uid, t.gid, f)
+	file.vol = t.vol
+	file.ino = t.vol.allocIno()
+	file.parent = t
+	if f.Mode()&os.ModeSymlink != 0 {
+		// symlinks hold their target rather than the contents of the file it points to
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		file.contents = file.emptyContents()
+		if _, err := file.contents.WriteAt([]byte(target), 0); err != nil {
+			return err
+		}
+		file.osLink = f
+	} else {
+		xattrNodeOf(file, nil).adopt(osXattrs(p))
+		overlay := file.contents.(*overlayContents)
+		overlay.owner = file
+		overlay.base.(*osFileContent).vol = t.vol
+	}
+	t.files[f.Name()] = file
+	t.indexAdd(f.Name())
+	t.vol.add(file.uid, 0, 1)
+	return nil
+}
+
+// Refresh re-reads the listing of a directory imported by FromOS. Entries that
+// have not been modified through memphis are brought in line with the disk: new
+// files and directories appear, ones deleted from disk are removed, and files and
+// symlinks that changed are imported again. Entries created or modified through
+// memphis are kept. Subdirectories are not refreshed. As with any other change to
+// its entries, the directory's times are updated from the tree's clock.
+func (t *Tree) Refresh() error {
+	t.ready.Do(t.deferred)
+	if t.osPath == "" {
+		return nil
+	}
+	files, err := ioutil.ReadDir(t.osPath)
+	if err != nil {
+		return err
+	}
+	changed := false
+	defer func() {
+		if changed {
+			t.entriesChanged()
+		}
+	}()
+
+	onDisk := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		name := f.Name()
+		onDisk[name] = struct{}{}
+		if d, ok := t.directories[name]; ok {
+			if d.osPath == "" || f.IsDir() {
+				continue
 			}
+			t.detach(name)
+			d.release()
+		} else if cur, ok := t.files[name]; ok {
+			imported := cur.osInfo()
+			if imported == nil || (!f.IsDir() && sameVersion(imported, f)) {
+				continue
+			}
+			t.detach(name)
+			cur.release()
+			// a cached descriptor still describes the old version
+			t.vol.fds.invalidate(path.Join(t.osPath, name))
+		}
+		changed = true
+		if err := t.importOS(f); err != nil {
+			return err
+		}
+		t.notify(OpCreate, name)
+	}
+
+	for name, d := range t.directories {
+		if _, ok := onDisk[name]; !ok && d.osPath != "" {
+			t.detach(name)
+			d.release()
+			t.notify(OpRemove, name)
+			changed = true
 		}
 	}
+	for name, f := range t.files {
+		if _, ok := onDisk[name]; !ok && f.osInfo() != nil {
+			t.detach(name)
+			f.release()
+			t.notify(OpRemove, name)
+			changed = true
+		}
+	}
+	return nil
+}
+
+// osInfo returns the imported version of a file that still mirrors the disk,
+// or nil if the file was created or modified through memphis.
+func (f *File) osInfo() os.FileInfo {
+	f.mu.Lock()
+	link := f.osLink
+	f.mu.Unlock()
+	if link != nil {
+		return link
+	}
+	overlay, ok := f.contents.(*overlayContents)
+	if !ok {
+		return nil
+	}
+	overlay.Lock()
+	defer overlay.Unlock()
+	base, ok := overlay.base.(*osFileContent)
+	if !ok || !overlay.pristine {
+		return nil
+	}
+	base.Lock()
+	defer base.Unlock()
+	return base.info
 }
 
 // FileFromOS creates a file representing an underlying OS file.
-// writes will transition the file contents to a memory buffer.
+// writes are held in memory, while unmodified ranges continue to be read from disk.
 func FileFromOS(path string, uid, gid uint32, info os.FileInfo) *File {
 	f := File{
-		name:       info.Name(),
-		mode:       info.Mode(),
-		uid:        uid,
-		gid:        gid,
-		createTime: info.ModTime(),
-		modTime:    info.ModTime(),
+		name: info.Name(),
+		inode: inode{
+			mode:       info.Mode(),
+			uid:        uid,
+			gid:        gid,
+			createTime: info.ModTime(),
+			modTime:    info.ModTime(),
+			accessTime: info.ModTime(),
+			changeTime: info.ModTime(),
+		},
 	}
 
 	osStatFile(&f, info.Sys())
 
-	f.contents = &copyOnWrite{FileContent: &osFileContent{path: path, size: info.Size()}}
+	f.contents = newOverlay(&osFileContent{path: path, size: info.Size(), info: info}, nil)
 	return &f
 }
@@ -0,0 +1,419 @@
+package memphis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// ChangeKind describes how an entry differs between two trees. Modified and
+// MetadataChanged may be reported together.
+type ChangeKind int
+
+const (
+	Added           ChangeKind = 1 << iota // Added entries are only in the new tree
+	Removed                                // Removed entries are only in the old tree
+	TypeChanged                            // TypeChanged entries changed between file, directory, symlink or device
+	Modified                               // Modified files have different contents
+	MetadataChanged                        // MetadataChanged entries have different modes, ownership or extended attributes
+)
+
+var changeKindNames = []string{"added", "removed", "type-changed", "modified", "metadata-changed"}
+
+func (k ChangeKind) String() string {
+	names := []string{}
+	for i, n := range changeKindNames {
+		if k&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// MarshalText encodes the kind by name, for JSON output
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Difference is an entry that differs between two trees. It encodes as JSON for machine-readable output.
+type Difference struct {
+	Path    string      `json:"path"`
+	Kind    ChangeKind  `json:"kind"`
+	OldMode os.FileMode `json:"old_mode,omitempty"`
+	NewMode os.FileMode `json:"new_mode,omitempty"`
+	OldSize int64       `json:"old_size,omitempty"`
+	NewSize int64       `json:"new_size,omitempty"`
+
+	old, new *File
+}
+
+// diffHash is what Diff compares digests by, to skip subtrees that are the same
+var diffHash = HashOptions{Ownership: true, Xattrs: true}
+
+// Diff lists the entries that differ between the directories a and b, in path order.
+// Shared subtrees, and those whose memoized digests are equal, are skipped without being
+// compared. Files sharing contents are not read, and others only when their sizes match.
+// Entries beneath added or removed directories are listed too. Times, and
+// the metadata of a and b themselves, are not compared.
+func Diff(a, b *Tree) ([]Difference, error) {
+	diffs := []Difference{}
+	if err := diffDir(a, b, "", &diffs); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+func diffDir(a, b *Tree, prefix string, diffs *[]Difference) error {
+	if a == b {
+		return nil
+	}
+	// digests are only used if already known, as computing them reads every file
+	if ha, ok := a.memoHash(diffHash); ok {
+		if hb, ok := b.memoHash(diffHash); ok && ha == hb {
+			return nil
+		}
+	}
+
+	an, bn := a.Names(), b.Names()
+	for len(an) > 0 || len(bn) > 0 {
+		var n string
+		var ea, eb entry
+		switch {
+		case len(bn) == 0 || (len(an) > 0 && an[0] < bn[0]):
+			n, an = an[0], an[1:]
+			ea = a.entry(n)
+		case len(an) == 0 || bn[0] < an[0]:
+			n, bn = bn[0], bn[1:]
+			eb = b.entry(n)
+		default:
+			n, an, bn = an[0], an[1:], bn[1:]
+			ea, eb = a.entry(n), b.entry(n)
+		}
+		if err := diffEntry(ea, eb, path.Join(prefix, n), diffs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffEntry(ea, eb entry, p string, diffs *[]Difference) error {
+	d := Difference{Path: p, old: ea.file, new: eb.file}
+	if ea.exists() {
+		d.OldMode, d.OldSize = ea.mode(), ea.size()
+	}
+	if eb.exists() {
+		d.NewMode, d.NewSize = eb.mode(), eb.size()
+	}
+
+	switch {
+	case !eb.exists():
+		d.Kind = Removed
+	case !ea.exists():
+		d.Kind = Added
+	case d.OldMode.Type() != d.NewMode.Type():
+		d.Kind = TypeChanged
+	default:
+		if d.OldMode != d.NewMode || !sameMeta(ea.inode(), eb.inode()) {
+			d.Kind |= MetadataChanged
+		}
+		if ea.file != nil {
+			same, err := sameContents(ea.file, eb.file)
+			if err != nil {
+				return err
+			}
+			if !same {
+				d.Kind |= Modified
+			}
+		}
+		if d.Kind != 0 {
+			*diffs = append(*diffs, d)
+		}
+		if ea.dir != nil {
+			return diffDir(ea.dir, eb.dir, p, diffs)
+		}
+		return nil
+	}
+
+	*diffs = append(*diffs, d)
+	if ea.dir != nil {
+		diffBeneath(ea.dir, p, Removed, diffs)
+	}
+	if eb.dir != nil {
+		diffBeneath(eb.dir, p, Added, diffs)
+	}
+	return nil
+}
+
+// diffBeneath lists everything beneath a directory that was added or removed
+func diffBeneath(t *Tree, prefix string, kind ChangeKind, diffs *[]Difference) {
+	// the callback never fails, so neither does the walk
+	t.Walk(func(p string, info os.FileInfo) error {
+		if p == "." {
+			return nil
+		}
+		d := Difference{Path: path.Join(prefix, p), Kind: kind}
+		f, _ := info.(*File)
+		mode, size := info.Mode()|os.ModeDir, int64(0)
+		if f != nil {
+			mode, size = f.mode, f.Size()
+		}
+		if kind == Added {
+			d.NewMode, d.NewSize, d.new = mode, size, f
+		} else {
+			d.OldMode, d.OldSize, d.old = mode, size, f
+		}
+		*diffs = append(*diffs, d)
+		return nil
+	})
+}
+
+func (e entry) inode() *inode {
+	if e.file != nil {
+		return &e.file.inode
+	}
+	return &e.dir.inode
+}
+
+func (e entry) mode() os.FileMode {
+	if e.file != nil {
+		return e.file.mode
+	}
+	return e.dir.mode | os.ModeDir
+}
+
+func (e entry) size() int64 {
+	if e.file != nil {
+		return e.file.Size()
+	}
+	return 0
+}
+
+// sameMeta compares the ownership and extended attributes of two nodes
+func sameMeta(a, b *inode) bool {
+	if a.uid != b.uid || a.gid != b.gid || len(a.xattrs) != len(b.xattrs) {
+		return false
+	}
+	for k, v := range a.xattrs {
+		if w, ok := b.xattrs[k]; !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return bytes.Equal(encodeACL(a.acl), encodeACL(b.acl))
+}
+
+// sameContents compares files, by their digests unless they share contents
+func sameContents(a, b *File) (bool, error) {
+	if a.contents == b.contents {
+		return true, nil
+	}
+	if a.Size() != b.Size() {
+		return false, nil
+	}
+	sa, err := a.sum()
+	if err != nil {
+		return false, err
+	}
+	sb, err := b.sum()
+	return sa == sb, err
+}
+
+// maxTextDiff is the largest file WriteDiff will show line changes for
+const maxTextDiff = 64 * 1024
+
+// diffContext is how many unchanged lines surround each hunk
+const diffContext = 3
+
+// WriteDiff writes differences as text: a line naming the kind and path of each,
+// followed by a unified diff when a small text file was added, removed or modified.
+func WriteDiff(w io.Writer, diffs []Difference) error {
+	for _, d := range diffs {
+		if _, err := fmt.Fprintf(w, "%s %s\n", d.Kind, d.Path); err != nil {
+			return err
+		}
+		if d.Kind&(Added|Removed|Modified) == 0 || (d.old == nil && d.new == nil) {
+			continue
+		}
+		oldLines, ok := textLines(d.old)
+		if !ok {
+			continue
+		}
+		newLines, ok := textLines(d.new)
+		if !ok {
+			continue
+		}
+		oldName, newName := "a/"+d.Path, "b/"+d.Path
+		if d.old == nil {
+			oldName = "/dev/null"
+		}
+		if d.new == nil {
+			newName = "/dev/null"
+		}
+		if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName); err != nil {
+			return err
+		}
+		if err := writeHunks(w, oldLines, newLines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textContent reads a file if it is small, regular and holds text. A missing file is empty.
+func textContent(f *File) (string, bool) {
+	if f == nil {
+		return "", true
+	}
+	if !f.mode.IsRegular() || f.Size() > maxTextDiff {
+		return "", false
+	}
+	b := f.Bytes()
+	if !utf8.Valid(b) || bytes.IndexByte(b, 0) >= 0 {
+		return "", false
+	}
+	return string(b), true
+}
+
+// textLines splits a small regular text file into lines, each keeping its newline so
+// a missing one at the end shows as a change. A missing file has none.
+func textLines(f *File) ([]string, bool) {
+	text, ok := textContent(f)
+	if !ok {
+		return nil, false
+	}
+	return splitLines(text), true
+}
+
+// diffOp is a line of a unified diff
+type diffOp struct {
+	kind         byte // kind is ' ', '-' or '+'
+	text         string
+	oldAt, newAt int // oldAt and newAt are the lines preceding the op in each file
+}
+
+// maxDiffCells bounds the table lineDiff builds, so large rewrites cannot exhaust memory
+const maxDiffCells = 4 << 20
+
+// lineDiff finds the changes between two lists of lines through their longest common
+// subsequence. Lines shared at the start and end are matched first, and if what remains
+// is too large to compare, no changes are found and false is returned.
+func lineDiff(a, b []string) ([]diffOp, bool) {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(ma)*len(mb) > maxDiffCells {
+		return nil, false
+	}
+
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(mb))
+	for k := 0; k < pre; k++ {
+		ops = append(ops, diffOp{' ', a[k], k, k})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{' ', ma[i], pre + i, pre + j})
+			i, j = i+1, j+1
+		case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', ma[i], pre + i, pre + j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', mb[j], pre + i, pre + j})
+			j++
+		}
+	}
+	for k := 0; k < suf; k++ {
+		ops = append(ops, diffOp{' ', a[pre+i+k], pre + i + k, pre + j + k})
+	}
+	return ops, true
+}
+
+// writeHunks writes the changes between two files, split by textLines, as unified
+// diff hunks. Files too different to compare are left without hunks.
+func writeHunks(w io.Writer, a, b []string) error {
+	ops, ok := lineDiff(a, b)
+	if !ok {
+		return nil
+	}
+	for start := 0; start < len(ops); {
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			return nil
+		}
+		// extend the hunk while changes are close enough to share context
+		last := first
+		for k := first; k < len(ops) && k-last <= 2*diffContext; k++ {
+			if ops[k].kind != ' ' {
+				last = k
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		oldStart, newStart := ops[from].oldAt, ops[from].newAt
+		if oldCount > 0 {
+			oldStart++
+		}
+		if newCount > 0 {
+			newStart++
+		}
+		if _, err := fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount); err != nil {
+			return err
+		}
+		for _, op := range ops[from:to] {
+			line := op.text
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			if _, err := fmt.Fprintf(w, "%c%s", op.kind, line); err != nil {
+				return err
+			}
+		}
+		start = to
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package memphis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteHunks(t *testing.T) {
+	numbered := func(n int, changes map[int]string) string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = string(rune('a'+i)) + "\n"
+			if c, ok := changes[i]; ok {
+				lines[i] = c + "\n"
+			}
+		}
+		return strings.Join(lines, "")
+	}
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "unchanged", a: "1\n2\n", b: "1\n2\n", want: ""},
+		{
+			name: "adjacent edits",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:    "1\n2\n3\nx\ny\n6\n7\n8\n",
+			want: "@@ -1,8 +1,8 @@\n 1\n 2\n 3\n-4\n-5\n+x\n+y\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant edits",
+			a:    numbered(16, nil),
+			b:    numbered(16, map[int]string{1: "B", 14: "O"}),
+			want: "@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -12,5 +12,5 @@\n l\n m\n n\n-o\n+O\n p\n",
+		},
+		{name: "delete", a: "1\n2\n3\n", b: "1\n3\n", want: "@@ -1,3 +1,2 @@\n 1\n-2\n 3\n"},
+		{name: "append", a: "1\n2\n", b: "1\n2\n3\n", want: "@@ -1,2 +1,3 @@\n 1\n 2\n+3\n"},
+		{name: "added", a: "", b: "a\n", want: "@@ -0,0 +1,1 @@\n+a\n"},
+		{name: "removed", a: "a\n", b: "", want: "@@ -1,1 +0,0 @@\n-a\n"},
+		{
+			name: "unterminated last line",
+			a:    "1\n2",
+			b:    "1\n2\n",
+			want: "@@ -1,2 +1,2 @@\n 1\n-2\n\\ No newline at end of file\n+2\n",
+		},
+		{
+			name: "edit before unterminated line",
+			a:    "1\n2",
+			b:    "x\n2",
+			want: "@@ -1,2 +1,2 @@\n-1\n+x\n 2\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := writeHunks(&out, splitLines(tt.a), splitLines(tt.b)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("writeHunks =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLineDiffTooLarge(t *testing.T) {
+	a, b := make([]string, 4096), make([]string, 4096)
+	for i := range a {
+		a[i], b[i] = string(rune(0x4e00+i))+"\n", string(rune(0x8000+i))+"\n"
+	}
+	if _, ok := lineDiff(a, b); ok {
+		t.Error("lineDiff compared files past maxDiffCells")
+	}
+	if _, ok := diff3(a, b, a); ok {
+		t.Error("diff3 merged files too different to compare")
+	}
+}
@@ -0,0 +1,120 @@
+package memphis
+
+import (
+	"io"
+	iofs "io/fs"
+	"os"
+	"sort"
+)
+
+// indexAdd records name in the directory's ordered index of entries
+func (t *Tree) indexAdd(name string) {
+	i := sort.SearchStrings(t.index, name)
+	if i < len(t.index) && t.index[i] == name {
+		return
+	}
+	t.index = append(t.index, "")
+	copy(t.index[i+1:], t.index[i:])
+	t.index[i] = name
+	t.invalidateHash()
+}
+
+// indexRemove drops name from the directory's ordered index of entries
+func (t *Tree) indexRemove(name string) {
+	i := sort.SearchStrings(t.index, name)
+	if i < len(t.index) && t.index[i] == name {
+		t.index = append(t.index[:i], t.index[i+1:]...)
+		t.invalidateHash()
+	}
+}
+
+// Names lists the entries of the directory, sorted by name
+func (t *Tree) Names() []string {
+	t.ready.Do(t.deferred)
+	return append([]string{}, t.index...)
+}
+
+// namesAfter lists up to n entries sorting after cursor, or all of them when n <= 0
+func (t *Tree) namesAfter(cursor string, n int) []string {
+	t.ready.Do(t.deferred)
+	i := sort.SearchStrings(t.index, cursor)
+	if i < len(t.index) && t.index[i] == cursor {
+		i++
+	}
+	rest := t.index[i:]
+	if n > 0 && len(rest) > n {
+		rest = rest[:n]
+	}
+	return append([]string{}, rest...)
+}
+
+// info describes the entry under name
+func (t *Tree) info(name string) os.FileInfo {
+	e := t.entry(name)
+	if e.dir != nil {
+		return &DirMeta{name, e.dir}
+	}
+	if e.file != nil {
+		return e.file
+	}
+	return nil
+}
+
+// DirFile is an open directory, listed in name order. Its position is a cursor
+// naming the last entry returned, so listings resume correctly when entries
+// are created or removed between calls.
+type DirFile struct {
+	dir    *Tree
+	cursor string
+}
+
+// OpenDir opens the directory for listing
+func (t *Tree) OpenDir() *DirFile {
+	return &DirFile{dir: t}
+}
+
+// Stat describes the directory
+func (d *DirFile) Stat() (iofs.FileInfo, error) {
+	return &DirMeta{d.dir.name, d.dir}, nil
+}
+
+// Read fails, as directories have no contents
+func (d *DirFile) Read([]byte) (int, error) {
+	return 0, ErrIsDir
+}
+
+// Close releases the directory
+func (d *DirFile) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory, as fs.ReadDirFile. When n > 0,
+// io.EOF is returned once there are no more. When n <= 0, all remaining entries are returned.
+func (d *DirFile) ReadDir(n int) ([]iofs.DirEntry, error) {
+	names := d.dir.namesAfter(d.cursor, n)
+	if len(names) == 0 && n > 0 {
+		return nil, io.EOF
+	}
+	entries := make([]iofs.DirEntry, 0, len(names))
+	for _, name := range names {
+		if info := d.dir.info(name); info != nil {
+			entries = append(entries, iofs.FileInfoToDirEntry(info))
+		}
+	}
+	if len(names) > 0 {
+		d.cursor = names[len(names)-1]
+	}
+	d.dir.accessed(d.dir.vol.atimePolicy(), d.dir.vol.now())
+	return entries, nil
+}
+
+// Cursor returns the position of the listing, for resuming it with Seek
+func (d *DirFile) Cursor() string {
+	return d.cursor
+}
+
+// Seek moves the listing to just after the entry named by cursor. The empty
+// cursor rewinds to the start. The entry need no longer exist.
+func (d *DirFile) Seek(cursor string) {
+	d.cursor = cursor
+}
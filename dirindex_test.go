@@ -0,0 +1,53 @@
+package memphis
+
+import (
+	"io"
+	iofs "io/fs"
+	"strings"
+	"testing"
+)
+
+func entryNames(entries []iofs.DirEntry) string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func TestDirFile(t *testing.T) {
+	root := New()
+	for _, n := range []string{"d", "b", "e", "a"} {
+		mustWrite(t, root, n, "data")
+	}
+	if got := strings.Join(root.Names(), ","); got != "a,b,d,e" {
+		t.Errorf("Names = %s, want sorted", got)
+	}
+
+	dir := root.OpenDir()
+	first, err := dir.ReadDir(2)
+	if err != nil || entryNames(first) != "a,b" {
+		t.Fatalf("first page = %s, %v", entryNames(first), err)
+	}
+	// entries created and removed between pages do not disturb the listing
+	mustWrite(t, root, "c", "data")
+	if err := root.AsBillyFS(0, 0).Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := dir.ReadDir(0)
+	if err != nil || entryNames(rest) != "c,d,e" {
+		t.Errorf("rest = %s, %v", entryNames(rest), err)
+	}
+	if _, err := dir.ReadDir(1); err != io.EOF {
+		t.Errorf("ReadDir past the end = %v, want io.EOF", err)
+	}
+
+	resumed := root.OpenDir()
+	resumed.Seek("b")
+	if page, _ := resumed.ReadDir(1); entryNames(page) != "c" || resumed.Cursor() != "c" {
+		t.Errorf("resumed after a removed entry at %s, cursor %q", entryNames(page), resumed.Cursor())
+	}
+	if _, err := resumed.Read(nil); err != ErrIsDir {
+		t.Errorf("Read of a directory = %v, want ErrIsDir", err)
+	}
+}
@@ -2,10 +2,100 @@ package memphis
 
 import (
 	"errors"
+	"os"
+	"syscall"
 )
 
+// Errors are syscall.Errno values, so that errors.Is matches them against both
+// errno values and the fs.Err* errors, and front ends can translate them faithfully.
+// Operations on paths wrap them in *fs.PathError or *os.LinkError.
+
 // ErrNotDir indicates the proposed location is not a directory
-var ErrNotDir = errors.New("ENotDir")
+var ErrNotDir error = syscall.ENOTDIR
 
 // ErrExists indicates a file already exists at a location
-var ErrExists = errors.New("EExists")
+var ErrExists error = syscall.EEXIST
+
+// ErrNoSpace indicates a limit on the size of the tree has been reached
+var ErrNoSpace error = syscall.ENOSPC
+
+// ErrQuota indicates a user has exhausted their quota
+var ErrQuota error = syscall.EDQUOT
+
+// ErrStale indicates a file changed on disk after it was imported
+var ErrStale error = syscall.ESTALE
+
+// ErrOverflow indicates events were dropped because a watcher was not keeping up
+var ErrOverflow error = syscall.EOVERFLOW
+
+// ErrNoAttr indicates an extended attribute does not exist
+var ErrNoAttr error = errNoAttr
+
+// ErrNotSupported indicates an operation is not supported, such as an unknown attribute namespace
+var ErrNotSupported error = syscall.ENOTSUP
+
+// ErrRange indicates a name or value is larger than allowed
+var ErrRange error = syscall.ERANGE
+
+// ErrWouldBlock indicates a lock is held elsewhere and the request asked not to wait
+var ErrWouldBlock error = syscall.EAGAIN
+
+// ErrDeadlock indicates waiting for a lock would deadlock
+var ErrDeadlock error = syscall.EDEADLK
+
+// ErrBadHandle indicates a handle was not opened for the requested kind of access
+var ErrBadHandle error = syscall.EBADF
+
+// ErrLoop indicates too many symlinks were encountered resolving a path
+var ErrLoop error = syscall.ELOOP
+
+// ErrIsDir indicates a directory was found where a file was expected
+var ErrIsDir error = syscall.EISDIR
+
+// ErrNotEmpty indicates a directory has entries, preventing it being removed or replaced
+var ErrNotEmpty error = syscall.ENOTEMPTY
+
+// ErrCrossDevice indicates resolving a path would leave the directory it was confined to,
+// or an entry would be renamed into a different tree
+var ErrCrossDevice error = syscall.EXDEV
+
+// ErrNotPermitted indicates an operation is reserved to the owner of a file or a privileged user
+var ErrNotPermitted error = syscall.EPERM
+
+// errno translates the errors of the os package to the equivalent errno
+func errno(err error) error {
+	switch {
+	case errors.Is(err, os.ErrClosed):
+		// os.File reports use of a closed handle with os.ErrClosed itself
+		return err
+	case err == os.ErrNotExist:
+		return syscall.ENOENT
+	case err == os.ErrExist:
+		return syscall.EEXIST
+	case err == os.ErrPermission:
+		return syscall.EACCES
+	case err == os.ErrInvalid:
+		return syscall.EINVAL
+	}
+	return err
+}
+
+// pathError describes a failed operation on a path, as *fs.PathError
+func pathError(op, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &os.PathError{Op: op, Path: path, Err: errno(err)}
+}
+
+// linkError describes a failed operation on a pair of paths, as *os.LinkError
+func linkError(op, oldpath, newpath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &os.LinkError{Op: op, Old: oldpath, New: newpath, Err: errno(err)}
+}
@@ -0,0 +1,64 @@
+package memphis
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestPathError(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		errno syscall.Errno
+		is    error
+	}{
+		{os.ErrNotExist, syscall.ENOENT, fs.ErrNotExist},
+		{os.ErrExist, syscall.EEXIST, fs.ErrExist},
+		{os.ErrPermission, syscall.EACCES, fs.ErrPermission},
+		{ErrNotDir, syscall.ENOTDIR, ErrNotDir},
+	} {
+		err := pathError("op", "p", c.err)
+		var pe *fs.PathError
+		if !errors.As(err, &pe) || pe.Op != "op" || pe.Path != "p" {
+			t.Errorf("pathError(%v) = %#v, want a path error", c.err, err)
+			continue
+		}
+		if pe.Err != c.errno || !errors.Is(err, c.is) {
+			t.Errorf("pathError(%v) wraps %v, want %v", c.err, pe.Err, c.errno)
+		}
+	}
+	// an existing path error keeps the path it describes
+	inner := pathError("lstat", "inner", os.ErrNotExist)
+	if err := pathError("open", "outer", inner); err != inner {
+		t.Errorf("pathError rewrapped %v as %v", inner, err)
+	}
+	if pathError("op", "p", nil) != nil || linkError("op", "a", "b", nil) != nil {
+		t.Error("a nil error was wrapped")
+	}
+	// os.ErrClosed is kept as it is, as os.File reports it
+	if err := pathError("read", "p", os.ErrClosed); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("pathError(ErrClosed) = %v", err)
+	}
+}
+
+func TestBillyErrors(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+
+	_, err := b.Stat("missing")
+	var pe *os.PathError
+	if !errors.As(err, &pe) || pe.Path != "missing" || pe.Err != syscall.ENOENT {
+		t.Errorf("Stat of a missing file = %#v, want ENOENT for its path", err)
+	}
+	err = b.Rename("missing", "other")
+	var le *os.LinkError
+	if !errors.As(err, &le) || le.Old != "missing" || le.New != "other" || !os.IsNotExist(err) {
+		t.Errorf("Rename of a missing file = %#v, want a link error", err)
+	}
+	if _, err := b.Stat("f/x"); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Stat beneath a file = %v, want ENOTDIR", err)
+	}
+}
@@ -0,0 +1,262 @@
+package memphis
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDescriptorCacheSize is how many OS files a tree keeps open by default
+	defaultDescriptorCacheSize = 64
+	// descriptorRevalidateInterval is how often a cached descriptor is checked against its path
+	descriptorRevalidateInterval = time.Second
+	// readaheadSize is how much is read from disk when access to a file looks sequential
+	readaheadSize = 128 * 1024
+)
+
+// SetDescriptorCache sets how many underlying OS files the tree this directory
+// belongs to may keep open for reading. A size of 0 disables the cache, opening
+// the file on every read.
+func (t *Tree) SetDescriptorCache(size int) {
+	t.vol.fds.resize(size)
+}
+
+// fdCache is a bounded LRU of open descriptors for files backing FromOS trees.
+// Descriptors pinned for snapshots are kept apart from those shared by path,
+// but count against the same bound.
+type fdCache struct {
+	sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+	pins    *list.List
+}
+
+// cachedFD is an open descriptor shared by all readers of a path
+type cachedFD struct {
+	sync.Mutex
+	path    string
+	fp      *os.File
+	info    os.FileInfo
+	checked time.Time
+	refs    int
+	evicted bool
+	pin     *list.Element // pin is set while the descriptor is pinned for a snapshot
+
+	// sequential readahead state
+	lastEnd int64
+	ra      []byte
+	raOff   int64
+	raEOF   bool
+}
+
+func newFDCache(size int) *fdCache {
+	return &fdCache{
+		max:     size,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		pins:    list.New(),
+	}
+}
+
+func (c *fdCache) resize(size int) {
+	c.Lock()
+	defer c.Unlock()
+	c.max = size
+	c.trim()
+}
+
+// acquire returns an open descriptor for path, which must be passed to release when done
+func (c *fdCache) acquire(path string) (*cachedFD, error) {
+	c.Lock()
+	if e, ok := c.entries[path]; ok {
+		fd := e.Value.(*cachedFD)
+		if time.Since(fd.checked) < descriptorRevalidateInterval {
+			c.lru.MoveToFront(e)
+			fd.refs++
+			c.Unlock()
+			return fd, nil
+		}
+		c.Unlock()
+		info, err := os.Stat(path)
+		c.Lock()
+		if cur, ok := c.entries[path]; ok && cur == e {
+			if err == nil && sameVersion(info, fd.info) {
+				fd.checked = time.Now()
+				c.lru.MoveToFront(e)
+				fd.refs++
+				c.Unlock()
+				return fd, nil
+			}
+			// the file changed underneath us.
+			c.evict(e)
+		}
+	}
+	c.Unlock()
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	fd := &cachedFD{path: path, fp: fp, info: info, checked: time.Now(), refs: 1, lastEnd: -1}
+
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[path]; ok {
+		c.evict(e)
+	}
+	if c.max > 0 {
+		c.entries[path] = c.lru.PushFront(fd)
+		c.trim()
+	} else {
+		fd.evicted = true
+	}
+	return fd, nil
+}
+
+// release returns a descriptor obtained from acquire
+func (c *fdCache) release(fd *cachedFD) {
+	c.Lock()
+	defer c.Unlock()
+	fd.refs--
+	if fd.evicted && fd.refs == 0 {
+		fd.fp.Close()
+	}
+}
+
+// invalidate drops any cached descriptor for path
+func (c *fdCache) invalidate(path string) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[path]; ok {
+		c.evict(e)
+	}
+}
+
+// pin keeps an acquired descriptor open for a snapshot, apart from the descriptors shared
+// by path. If the cache is full of pins the oldest is closed, and false is returned if
+// the descriptor cannot be kept at all.
+func (c *fdCache) pin(fd *cachedFD) bool {
+	c.Lock()
+	defer c.Unlock()
+	if fd.evicted || fd.pin != nil || c.max <= 0 {
+		return false
+	}
+	if e, ok := c.entries[fd.path]; ok && e.Value == fd {
+		c.lru.Remove(e)
+		delete(c.entries, fd.path)
+	}
+	fd.pin = c.pins.PushFront(fd)
+	c.trim()
+	return !fd.evicted
+}
+
+// retainPinned takes a reference to a pinned descriptor, failing if it has since been closed
+func (c *fdCache) retainPinned(fd *cachedFD) bool {
+	c.Lock()
+	defer c.Unlock()
+	if fd.evicted {
+		return false
+	}
+	c.pins.MoveToFront(fd.pin)
+	fd.refs++
+	return true
+}
+
+// unpin closes a pinned descriptor once its readers are done with it
+func (c *fdCache) unpin(fd *cachedFD) {
+	c.Lock()
+	defer c.Unlock()
+	if !fd.evicted {
+		c.evictPin(fd.pin)
+	}
+}
+
+// flush closes every cached and pinned descriptor
+func (c *fdCache) flush() {
+	c.Lock()
+	defer c.Unlock()
+	for c.lru.Len() > 0 {
+		c.evict(c.lru.Back())
+	}
+	for c.pins.Len() > 0 {
+		c.evictPin(c.pins.Back())
+	}
+}
+
+// trim closes descriptors until the cache is within its bound, preferring to keep pins
+func (c *fdCache) trim() {
+	for c.lru.Len()+c.pins.Len() > c.max {
+		if c.lru.Len() > 0 {
+			c.evict(c.lru.Back())
+		} else {
+			c.evictPin(c.pins.Back())
+		}
+	}
+}
+
+func (c *fdCache) evictPin(e *list.Element) {
+	fd := e.Value.(*cachedFD)
+	c.pins.Remove(e)
+	fd.evicted = true
+	if fd.refs == 0 {
+		fd.fp.Close()
+	}
+}
+
+func (c *fdCache) evict(e *list.Element) {
+	fd := e.Value.(*cachedFD)
+	c.lru.Remove(e)
+	delete(c.entries, fd.path)
+	fd.evicted = true
+	if fd.refs == 0 {
+		fd.fp.Close()
+	}
+}
+
+// sameVersion checks if two stats of a path refer to the same, unmodified file
+func sameVersion(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// readAt reads from the descriptor, reading ahead when access is sequential
+func (fd *cachedFD) readAt(buf []byte, offset int64) (n int, err error) {
+	fd.Lock()
+	defer fd.Unlock()
+	defer func() {
+		fd.lastEnd = offset + int64(n)
+	}()
+
+	if fd.ra != nil && offset >= fd.raOff && offset+int64(len(buf)) <= fd.raOff+int64(len(fd.ra)) {
+		return copy(buf, fd.ra[offset-fd.raOff:]), nil
+	}
+	if offset != fd.lastEnd || len(buf) >= readaheadSize {
+		return fd.fp.ReadAt(buf, offset)
+	}
+
+	if fd.ra == nil {
+		fd.ra = make([]byte, readaheadSize)
+	}
+	fd.ra = fd.ra[:cap(fd.ra)]
+	l, rerr := fd.fp.ReadAt(fd.ra, offset)
+	if rerr != nil && rerr != io.EOF {
+		fd.ra = nil
+		return 0, rerr
+	}
+	fd.ra = fd.ra[:l]
+	fd.raOff = offset
+	fd.raEOF = rerr == io.EOF
+	n = copy(buf, fd.ra)
+	if n < len(buf) && fd.raEOF {
+		err = io.EOF
+	}
+	return n, err
+}
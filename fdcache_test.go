@@ -0,0 +1,60 @@
+package memphis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFDCache(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i, n := range []string{"a", "b", "c"} {
+		paths[i] = filepath.Join(dir, n)
+		if err := os.WriteFile(paths[i], []byte(n), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newFDCache(2)
+	a, err := c.acquire(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.acquire(paths[0]); again != a {
+		t.Error("a cached path was opened again")
+	} else {
+		c.release(again)
+	}
+	for _, p := range paths[1:] {
+		fd, err := c.acquire(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.release(fd)
+	}
+	if len(c.entries) != 2 || c.entries[paths[0]] != nil {
+		t.Fatalf("cache holds %d descriptors, want the 2 most recent", len(c.entries))
+	}
+	// the evicted descriptor stays open until its last reader is done
+	if _, err := a.fp.Stat(); err != nil {
+		t.Errorf("evicted descriptor closed while in use: %v", err)
+	}
+	c.release(a)
+	if _, err := a.fp.Stat(); err == nil {
+		t.Error("evicted descriptor left open after release")
+	}
+	c.flush()
+	if len(c.entries) != 0 || c.lru.Len() != 0 {
+		t.Errorf("flush left %d descriptors cached", len(c.entries))
+	}
+}
+
+func TestFDCacheMissing(t *testing.T) {
+	c := newFDCache(2)
+	if _, err := c.acquire(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("acquire of a missing file = %v, want ErrNotExist", err)
+	}
+	if len(c.entries) != 0 {
+		t.Error("a failed open was cached")
+	}
+}
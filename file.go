@@ -3,18 +3,24 @@ package memphis
 import (
 	"io"
 	"os"
+	"sync"
 	"time"
 )
 
 // File holds the metadata of a FS object
 type File struct {
-	name       string
-	mode       os.FileMode
-	uid        uint32
-	gid        uint32
-	createTime time.Time
-	modTime    time.Time
-	contents   FileContent
+	name   string
+	vol    *volume
+	parent *Tree
+	inode
+	contents FileContent
+
+	contentSum *Digest     // contentSum memoizes the digest of the contents
+	osLink     os.FileInfo // osLink is the version of a symlink imported from disk, until it is rewritten
+
+	mu       sync.Mutex // mu serializes writes, so appends are atomic
+	opens    int        // opens counts handles to the file that have not been closed
+	unlinked bool       // unlinked is set once the file is removed while handles are still open
 }
 
 // Name returns the file name
@@ -42,9 +48,41 @@ func (f *File) IsDir() bool {
 	return false
 }
 
-// Sys is a wildcard in the OS interface
+// Sys returns the full metadata of the file. It is a *syscall.Stat_t on Linux,
+// and a *Stat elsewhere.
 func (f *File) Sys() interface{} {
-	return nil
+	return sys(f.Stat())
+}
+
+// emptyContents creates a new in-memory buffer accounted to the file
+func (f *File) emptyContents() *memoryContents {
+	return &memoryContents{bytes: []byte{}, acct: f, vol: f.vol}
+}
+
+// truncate changes the size of the file contents
+func (f *File) truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if size == 0 {
+		f.charge(-residentBytes(f.contents))
+		discardContents(f.contents)
+		f.contents = f.emptyContents()
+		return nil
+	}
+
+	var truncatable TruncatableContents
+	var ok bool
+	if truncatable, ok = f.contents.(TruncatableContents); !ok {
+		fc, err := memBufferCharged(f.contents, f)
+		if err != nil {
+			return err
+		}
+		discardContents(f.contents)
+		f.contents = fc
+		truncatable = f.contents.(TruncatableContents)
+	}
+	return truncatable.Truncate(size)
 }
 
 // Bytes returns a direct buffer of the contents of the file
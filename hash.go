@@ -0,0 +1,170 @@
+package memphis
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sort"
+)
+
+// Digest is a content address of a file or directory tree
+type Digest [sha256.Size]byte
+
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// HashOptions selects what metadata contributes to tree digests, beyond names, modes and contents
+type HashOptions struct {
+	Ownership bool // Ownership includes the uid and gid of entries
+	Xattrs    bool // Xattrs includes extended attributes, and with them ACLs
+}
+
+// hashMemo holds the digests computed for a directory, by the options used
+type hashMemo map[HashOptions]Digest
+
+// Hash returns a digest of everything beneath the directory: the names, modes and
+// contents of its entries, recursively. Times, and the directory's own metadata,
+// do not contribute. Digests are memoized and recomputed only for the directories
+// changed since, so comparing large trees costs in proportion to what changed.
+// Files changed on disk under ConsistencyLive are only noticed once refreshed.
+func (t *Tree) Hash() (Digest, error) {
+	return t.HashWith(HashOptions{})
+}
+
+// HashWith returns a digest of everything beneath the directory, as Hash, including
+// the metadata selected by opts.
+func (t *Tree) HashWith(opts HashOptions) (Digest, error) {
+	t.ready.Do(t.deferred)
+	t.vol.hashLock.Lock()
+	d, ok := t.hashes[opts]
+	gen := t.vol.hashGen
+	t.vol.hashLock.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	h := sha256.New()
+	for _, n := range t.Names() {
+		var sum Digest
+		var err error
+		var node *inode
+		var mode os.FileMode
+		if sub, ok := t.directories[n]; ok {
+			sum, err = sub.HashWith(opts)
+			node, mode = &sub.inode, sub.mode|os.ModeDir
+		} else {
+			f := t.files[n]
+			sum, err = f.sum()
+			node, mode = &f.inode, f.mode
+		}
+		if err != nil {
+			return Digest{}, err
+		}
+		hashEntry(h, n, node, mode, sum, opts)
+	}
+	copy(d[:], h.Sum(nil))
+
+	t.vol.hashLock.Lock()
+	// a change made while hashing may have been missed, so the digest is not kept
+	if t.vol.hashGen == gen {
+		if t.hashes == nil {
+			t.hashes = make(hashMemo)
+		}
+		t.hashes[opts] = d
+	}
+	t.vol.hashLock.Unlock()
+	return d, nil
+}
+
+// memoHash returns the digest of the directory if it is memoized, without computing it
+func (t *Tree) memoHash(opts HashOptions) (Digest, bool) {
+	t.vol.hashLock.Lock()
+	defer t.vol.hashLock.Unlock()
+	d, ok := t.hashes[opts]
+	return d, ok
+}
+
+// hashEntry adds an entry of a directory to its digest
+func hashEntry(h hash.Hash, name string, n *inode, mode os.FileMode, sum Digest, opts HashOptions) {
+	hashBytes(h, []byte(name))
+	binary.Write(h, binary.BigEndian, uint32(mode))
+	if opts.Ownership {
+		binary.Write(h, binary.BigEndian, [2]uint32{n.uid, n.gid})
+	}
+	if opts.Xattrs {
+		keys := make([]string, 0, len(n.xattrs))
+		for k := range n.xattrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		binary.Write(h, binary.BigEndian, uint64(len(keys)))
+		for _, k := range keys {
+			hashBytes(h, []byte(k))
+			hashBytes(h, n.xattrs[k])
+		}
+		hashBytes(h, encodeACL(n.acl))
+	}
+	h.Write(sum[:])
+}
+
+// hashBytes adds length-prefixed bytes to a digest, so adjacent fields cannot run together
+func hashBytes(h hash.Hash, b []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(b)))
+	h.Write(b)
+}
+
+// sum returns the digest of the file's contents, memoized until it is next written
+func (f *File) sum() (Digest, error) {
+	f.vol.hashLock.Lock()
+	s := f.contentSum
+	gen := f.vol.hashGen
+	f.vol.hashLock.Unlock()
+	if s != nil {
+		return *s, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f.contents, 0, f.Size())); err != nil {
+		return Digest{}, err
+	}
+	var d Digest
+	copy(d[:], h.Sum(nil))
+
+	f.vol.hashLock.Lock()
+	if f.vol.hashGen == gen {
+		f.contentSum = &d
+	}
+	f.vol.hashLock.Unlock()
+	return d, nil
+}
+
+// invalidateHash drops the memoized digests of the directory and those containing it.
+// A directory without digests has none above it either, so the walk up stops there.
+func (t *Tree) invalidateHash() {
+	if t.vol == nil {
+		return
+	}
+	t.vol.hashLock.Lock()
+	defer t.vol.hashLock.Unlock()
+	t.vol.hashGen++
+	for cur := t; cur != nil && cur.hashes != nil; cur = cur.parent {
+		cur.hashes = nil
+	}
+}
+
+// invalidateHash drops the memoized digests depending on the file
+func (f *File) invalidateHash(contents bool) {
+	if contents && f.vol != nil {
+		f.vol.hashLock.Lock()
+		f.vol.hashGen++
+		f.contentSum = nil
+		f.vol.hashLock.Unlock()
+	}
+	if f.parent != nil {
+		f.parent.invalidateHash()
+	}
+}
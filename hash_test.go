@@ -0,0 +1,64 @@
+package memphis
+
+import (
+	"os"
+	"testing"
+)
+
+// hashTree builds a directory holding a file, in a new tree
+func hashTree(t *testing.T, uid uint32) (*Tree, *Tree) {
+	t.Helper()
+	root := New()
+	d, err := root.CreateDir("d", uid, uid, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Create("f", uid, uid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root, d
+}
+
+func TestHash(t *testing.T) {
+	a, ad := hashTree(t, 0)
+	b, _ := hashTree(t, 1)
+	ha, err := a.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hb, _ := b.Hash(); hb != ha {
+		t.Error("trees differing only in ownership hash differently by default")
+	}
+	oa, _ := a.HashWith(HashOptions{Ownership: true})
+	if ob, _ := b.HashWith(HashOptions{Ownership: true}); oa == ob {
+		t.Error("ownership does not contribute when selected")
+	}
+
+	if _, ok := ad.memoHash(HashOptions{}); !ok {
+		t.Error("the digest of a subdirectory was not memoized")
+	}
+	mustWrite(t, ad, "g", "data")
+	if _, ok := ad.memoHash(HashOptions{}); ok {
+		t.Error("a change left the directory's digest memoized")
+	}
+	if _, ok := a.memoHash(HashOptions{}); ok {
+		t.Error("a change left the parent's digest memoized")
+	}
+	if h, _ := a.Hash(); h == ha {
+		t.Error("adding a file did not change the digest")
+	}
+}
+
+func TestHashReadError(t *testing.T) {
+	root, _, p := importFile(t, "data")
+	root.SetDescriptorCache(0)
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Hash(); err == nil {
+		t.Error("Hash succeeded without the contents of a file")
+	}
+	if _, ok := root.memoHash(HashOptions{}); ok {
+		t.Error("a failed digest was memoized")
+	}
+}
@@ -0,0 +1,35 @@
+package memphis
+
+import (
+	"os"
+	"time"
+)
+
+// inode holds the metadata common to files and directories
+type inode struct {
+	ino        uint64 // ino identifies the file or directory within its tree, and is never reused
+	mode       os.FileMode
+	uid        uint32
+	gid        uint32
+	createTime time.Time // createTime is the birth time
+	modTime    time.Time
+	accessTime time.Time
+	changeTime time.Time // changeTime is when the inode was last changed, including its metadata
+	xattrs     xattrSet
+	acl        ACL
+}
+
+// newInode allocates the metadata of a new file or directory in the volume
+func (v *volume) newInode(uid, gid uint32, mode os.FileMode) inode {
+	now := v.now()
+	return inode{
+		ino:        v.allocIno(),
+		mode:       mode,
+		uid:        uid,
+		gid:        gid,
+		createTime: now,
+		modTime:    now,
+		accessTime: now,
+		changeTime: now,
+	}
+}
@@ -0,0 +1,268 @@
+package memphis
+
+import (
+	"math"
+	"os"
+	"sync"
+)
+
+// Operations for Flock, matching the values of flock(2)
+const (
+	LockShared    = 1 // LockShared takes a shared lock
+	LockExclusive = 2 // LockExclusive takes an exclusive lock
+	LockNonBlock  = 4 // LockNonBlock fails with ErrWouldBlock rather than waiting
+	LockUnlock    = 8 // LockUnlock releases a held lock
+)
+
+// RangeLockType is the kind of a byte-range lock
+type RangeLockType int
+
+// Byte-range lock kinds
+const (
+	RangeLockShared    RangeLockType = iota // RangeLockShared is a read lock, as F_RDLCK
+	RangeLockExclusive                      // RangeLockExclusive is a write lock, as F_WRLCK
+	RangeLockNone                           // RangeLockNone releases a range, as F_UNLCK
+)
+
+// RangeLock describes an fcntl-style lock on a range of a file.
+// A Len of 0 extends the lock to the end of the file, however large it grows.
+type RangeLock struct {
+	Type  RangeLockType
+	Start int64
+	Len   int64
+}
+
+// lockKind separates whole-file flock locks from byte-range locks, which do not interact
+type lockKind int
+
+const (
+	flockKind lockKind = iota
+	rangeKind
+)
+
+// heldLock is a lock owned by an open file handle
+type heldLock struct {
+	owner     *BillyFile
+	kind      lockKind
+	exclusive bool
+	start     int64
+	end       int64 // end is exclusive
+}
+
+func (l heldLock) conflicts(o heldLock) bool {
+	return l.owner != o.owner && l.kind == o.kind &&
+		(l.exclusive || o.exclusive) &&
+		l.start < o.end && o.start < l.end
+}
+
+// lockManager tracks the advisory locks on the files of a tree
+type lockManager struct {
+	sync.Mutex
+	cond    *sync.Cond
+	held    map[*File][]heldLock
+	waiting map[*BillyFile]waiter
+}
+
+// waiter is a lock an owner is blocked trying to take
+type waiter struct {
+	file *File
+	lock heldLock
+}
+
+func newLockManager() *lockManager {
+	m := &lockManager{
+		held:    make(map[*File][]heldLock),
+		waiting: make(map[*BillyFile]waiter),
+	}
+	m.cond = sync.NewCond(&m.Mutex)
+	return m
+}
+
+// defaultLocks manages locks for files that do not belong to a tree
+var defaultLocks = newLockManager()
+
+func (f *File) locks() *lockManager {
+	if f.vol == nil {
+		return defaultLocks
+	}
+	return f.vol.locks
+}
+
+// blockers lists the owners holding locks that conflict with l
+func (m *lockManager) blockers(f *File, l heldLock) []*BillyFile {
+	owners := []*BillyFile{}
+	for _, h := range m.held[f] {
+		if h.conflicts(l) {
+			owners = append(owners, h.owner)
+		}
+	}
+	return owners
+}
+
+// deadlocks checks if owner waiting for l would complete a cycle of waiting owners
+func (m *lockManager) deadlocks(f *File, l heldLock) bool {
+	seen := map[*BillyFile]bool{}
+	queue := m.blockers(f, l)
+	for len(queue) > 0 {
+		o := queue[0]
+		queue = queue[1:]
+		if o == l.owner {
+			return true
+		}
+		if seen[o] {
+			continue
+		}
+		seen[o] = true
+		if w, ok := m.waiting[o]; ok {
+			queue = append(queue, m.blockers(w.file, w.lock)...)
+		}
+	}
+	return false
+}
+
+// acquire takes a lock, waiting for conflicting locks to be released if wait is set
+func (m *lockManager) acquire(f *File, l heldLock, wait bool) error {
+	m.Lock()
+	defer m.Unlock()
+	for len(m.blockers(f, l)) > 0 {
+		if !wait {
+			return ErrWouldBlock
+		}
+		if m.deadlocks(f, l) {
+			return ErrDeadlock
+		}
+		m.waiting[l.owner] = waiter{f, l}
+		m.cond.Wait()
+		delete(m.waiting, l.owner)
+	}
+	m.set(f, l, true)
+	return nil
+}
+
+// set records l, replacing the owner's existing locks of the same kind over its range.
+// If add is false the range is only cleared.
+func (m *lockManager) set(f *File, l heldLock, add bool) {
+	kept := []heldLock{}
+	for _, h := range m.held[f] {
+		if h.owner != l.owner || h.kind != l.kind || h.end <= l.start || l.end <= h.start {
+			kept = append(kept, h)
+			continue
+		}
+		if h.start < l.start {
+			left := h
+			left.end = l.start
+			kept = append(kept, left)
+		}
+		if h.end > l.end {
+			right := h
+			right.start = l.end
+			kept = append(kept, right)
+		}
+	}
+	if add {
+		kept = append(kept, l)
+	}
+	if len(kept) == 0 {
+		delete(m.held, f)
+	} else {
+		m.held[f] = kept
+	}
+	m.cond.Broadcast()
+}
+
+// releaseAll drops every lock held by an owner
+func (m *lockManager) releaseAll(f *File, owner *BillyFile) {
+	m.Lock()
+	defer m.Unlock()
+	kept := []heldLock{}
+	for _, h := range m.held[f] {
+		if h.owner != owner {
+			kept = append(kept, h)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m.held, f)
+	} else {
+		m.held[f] = kept
+	}
+	m.cond.Broadcast()
+}
+
+// Flock applies or removes a whole-file advisory lock, as flock(2).
+// Locks are owned by the handle, and converting between shared and exclusive is allowed.
+func (bf *BillyFile) Flock(how int) error {
+	return pathError("flock", bf.Name(), bf.flock(how))
+}
+
+func (bf *BillyFile) flock(how int) error {
+	m := bf.File.locks()
+	l := heldLock{owner: bf, kind: flockKind, start: 0, end: math.MaxInt64}
+	switch how &^ LockNonBlock {
+	case LockShared:
+	case LockExclusive:
+		l.exclusive = true
+	case LockUnlock:
+		m.Lock()
+		defer m.Unlock()
+		m.set(bf.File, l, false)
+		return nil
+	default:
+		return os.ErrInvalid
+	}
+	return m.acquire(bf.File, l, how&LockNonBlock == 0)
+}
+
+func (r RangeLock) held(owner *BillyFile) (heldLock, error) {
+	if r.Start < 0 || r.Len < 0 {
+		return heldLock{}, os.ErrInvalid
+	}
+	l := heldLock{owner: owner, kind: rangeKind, exclusive: r.Type == RangeLockExclusive, start: r.Start, end: math.MaxInt64}
+	if r.Len > 0 {
+		l.end = r.Start + r.Len
+	}
+	return l, nil
+}
+
+// SetLock applies or removes a byte-range lock, as fcntl(2) F_SETLK or, if wait
+// is set, F_SETLKW. Locks are owned by the handle, like Linux open file description locks.
+// A blocking request that would deadlock fails with ErrDeadlock.
+func (bf *BillyFile) SetLock(r RangeLock, wait bool) error {
+	l, err := r.held(bf)
+	if err != nil {
+		return pathError("fcntl", bf.Name(), err)
+	}
+	m := bf.File.locks()
+	if r.Type == RangeLockNone {
+		m.Lock()
+		defer m.Unlock()
+		m.set(bf.File, l, false)
+		return nil
+	}
+	return pathError("fcntl", bf.Name(), m.acquire(bf.File, l, wait))
+}
+
+// GetLock reports a lock that would prevent r from being taken, as fcntl(2) F_GETLK.
+// If there is none, the returned lock has type RangeLockNone.
+func (bf *BillyFile) GetLock(r RangeLock) (RangeLock, error) {
+	l, err := r.held(bf)
+	if err != nil {
+		return r, pathError("fcntl", bf.Name(), err)
+	}
+	m := bf.File.locks()
+	m.Lock()
+	defer m.Unlock()
+	for _, h := range m.held[bf.File] {
+		if h.conflicts(l) {
+			found := RangeLock{Type: RangeLockShared, Start: h.start}
+			if h.exclusive {
+				found.Type = RangeLockExclusive
+			}
+			if h.end != math.MaxInt64 {
+				found.Len = h.end - h.start
+			}
+			return found, nil
+		}
+	}
+	r.Type = RangeLockNone
+	return r, nil
+}
@@ -0,0 +1,98 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// openHandles opens a file through two separate handles
+func openHandles(t *testing.T) (*BillyFile, *BillyFile) {
+	t.Helper()
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	handles := make([]*BillyFile, 2)
+	for i := range handles {
+		f, err := b.OpenFile("f", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles[i] = f.(*BillyFile)
+	}
+	return handles[0], handles[1]
+}
+
+func TestFlock(t *testing.T) {
+	a, b := openHandles(t)
+	if err := a.Flock(LockShared); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flock(LockShared | LockNonBlock); err != nil {
+		t.Errorf("second shared lock = %v", err)
+	}
+	if err := b.Flock(LockExclusive | LockNonBlock); !errors.Is(err, ErrWouldBlock) {
+		t.Errorf("exclusive lock over a shared one = %v, want ErrWouldBlock", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flock(LockExclusive | LockNonBlock); err != nil {
+		t.Errorf("exclusive lock once the other handle closed = %v", err)
+	}
+	if err := b.Flock(LockUnlock); err != nil {
+		t.Error(err)
+	}
+	if err := b.Flock(16); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Flock with an unknown operation = %v, want EINVAL", err)
+	}
+}
+
+func TestRangeLock(t *testing.T) {
+	a, b := openHandles(t)
+	if err := a.SetLock(RangeLock{Type: RangeLockExclusive, Start: 0, Len: 10}, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.GetLock(RangeLock{Type: RangeLockShared, Start: 5, Len: 1})
+	if err != nil || got != (RangeLock{Type: RangeLockExclusive, Start: 0, Len: 10}) {
+		t.Errorf("GetLock = %+v, %v", got, err)
+	}
+	if err := b.SetLock(RangeLock{Type: RangeLockShared, Start: 5, Len: 1}, false); !errors.Is(err, ErrWouldBlock) {
+		t.Errorf("overlapping lock = %v, want ErrWouldBlock", err)
+	}
+	if err := b.SetLock(RangeLock{Type: RangeLockExclusive, Start: 10}, false); err != nil {
+		t.Errorf("adjacent lock = %v", err)
+	}
+	if got, _ := a.GetLock(RangeLock{Type: RangeLockShared, Start: 0, Len: 10}); got.Type != RangeLockNone {
+		t.Errorf("GetLock reported the handle's own lock: %+v", got)
+	}
+	if err := a.SetLock(RangeLock{Type: RangeLockShared, Start: -1}, false); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("lock at a negative offset = %v, want EINVAL", err)
+	}
+}
+
+func TestRangeLockDeadlock(t *testing.T) {
+	a, b := openHandles(t)
+	a.SetLock(RangeLock{Type: RangeLockExclusive, Start: 0, Len: 10}, false)
+	b.SetLock(RangeLock{Type: RangeLockExclusive, Start: 10, Len: 10}, false)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.SetLock(RangeLock{Type: RangeLockExclusive, Start: 0, Len: 10}, true)
+	}()
+	m := a.File.locks()
+	for waiting := 0; waiting == 0; time.Sleep(time.Millisecond) {
+		m.Lock()
+		waiting = len(m.waiting)
+		m.Unlock()
+	}
+	if err := a.SetLock(RangeLock{Type: RangeLockExclusive, Start: 10, Len: 10}, true); !errors.Is(err, ErrDeadlock) {
+		t.Errorf("lock completing a cycle = %v, want ErrDeadlock", err)
+	}
+	a.SetLock(RangeLock{Type: RangeLockNone, Start: 0, Len: 10}, false)
+	if err := <-done; err != nil {
+		t.Errorf("waiting lock = %v once released", err)
+	}
+}
@@ -5,12 +5,26 @@ const Separator = "/"
 
 // New creates a new, empty memphis instance
 func New() *Tree {
-	return newTree(0, 0, 0777)
+	return NewWithClock(RealClock())
+}
+
+// NewWithClock creates a new, empty memphis instance taking all timestamps from
+// the clock, including that of the root directory. A nil clock is the real clock.
+func NewWithClock(c Clock) *Tree {
+	if c == nil {
+		c = RealClock()
+	}
+	vol := newVolume()
+	vol.clock = c
+	fs := newTree(vol, 0, 0, 0777)
+	fs.vol.add(fs.uid, 0, 1)
+	return fs
 }
 
 // FromOS creates a memphis instance overlayed on an OS subtree
 func FromOS(osPath string) *Tree {
-	fs := newTree(0, 0, 0777)
+	fs := newTree(newVolume(), 0, 0, 0777)
+	fs.vol.add(fs.uid, 0, 1)
 	fs.deferred = deferredOSDir(fs, osPath)
 	fs.ready.Do(fs.deferred)
 	return fs
@@ -0,0 +1,19 @@
+package memphis
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustWrite creates a file under name holding data
+func mustWrite(t *testing.T, dir *Tree, name, data string) *File {
+	t.Helper()
+	f, err := dir.Create(name, 0, 0, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.replace(strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
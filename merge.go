@@ -0,0 +1,408 @@
+package memphis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ConflictKind describes why a path could not be merged
+type ConflictKind int
+
+const (
+	ConflictContent      ConflictKind = iota // ConflictContent is when both sides changed a file's contents differently
+	ConflictDeleteModify                     // ConflictDeleteModify is when one side removed an entry the other changed
+	ConflictType                             // ConflictType is when the sides changed an entry to different types
+	ConflictMode                             // ConflictMode is when both sides changed an entry's mode, ownership or extended attributes differently
+)
+
+func (k ConflictKind) String() string {
+	switch k {
+	case ConflictContent:
+		return "content"
+	case ConflictDeleteModify:
+		return "delete/modify"
+	case ConflictType:
+		return "type"
+	case ConflictMode:
+		return "mode"
+	}
+	return "unknown"
+}
+
+// Conflict is a path changed incompatibly by both sides of a merge
+type Conflict struct {
+	Path string
+	Kind ConflictKind
+}
+
+// Resolution settles a conflict
+type Resolution int
+
+const (
+	Unresolved Resolution = iota // Unresolved keeps our side and reports the conflict
+	KeepOurs                     // KeepOurs keeps our side
+	TakeTheirs                   // TakeTheirs replaces our side with theirs
+)
+
+// MergePolicy configures how Merge handles conflicts
+type MergePolicy struct {
+	// Resolve, if set, is asked to settle each conflict as it is found
+	Resolve func(Conflict) Resolution
+	// TextMerge merges changes to small text files line by line, as diff3,
+	// so only changes to the same lines conflict.
+	TextMerge bool
+}
+
+// merger tracks the state of a merge
+type merger struct {
+	policy    MergePolicy
+	conflicts []Conflict
+	copier    *copier
+}
+
+// Merge applies the changes theirs made to base onto ours, which ours must have been
+// copied from too. Changes only one side made are taken, and changes both sides
+// made differently are conflicts for the policy to resolve. The conflicts left
+// unresolved are returned, with ours kept at those paths.
+func Merge(base, ours, theirs *Tree, policy MergePolicy) ([]Conflict, error) {
+	m := &merger{policy: policy, copier: newCopier(context.Background(), CopyOptions{})}
+	err := m.mergeDir(base, ours, theirs, "")
+	return m.conflicts, err
+}
+
+func (m *merger) mergeDir(base, ours, theirs *Tree, prefix string) error {
+	if base != nil {
+		hb, err := base.HashWith(diffHash)
+		if err != nil {
+			return err
+		}
+		ht, err := theirs.HashWith(diffHash)
+		if err != nil {
+			return err
+		}
+		if hb == ht {
+			return nil
+		}
+	}
+
+	names := map[string]struct{}{}
+	for _, t := range []*Tree{base, ours, theirs} {
+		if t == nil {
+			continue
+		}
+		for _, n := range t.Names() {
+			names[n] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+
+	for _, n := range sorted {
+		var eb entry
+		if base != nil {
+			eb = base.entry(n)
+		}
+		if err := m.mergeEntry(ours, n, eb, ours.entry(n), theirs.entry(n), path.Join(prefix, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *merger) mergeEntry(ours *Tree, name string, eb, eo, et entry, p string) error {
+	if same, err := sameEntry(et, eb); err != nil || same {
+		return err
+	}
+	if same, err := sameEntry(eo, eb); err != nil {
+		return err
+	} else if same {
+		return m.take(ours, name, et, p)
+	}
+	if same, err := sameEntry(eo, et); err != nil || same {
+		return err
+	}
+
+	switch {
+	case !eo.exists() || !et.exists():
+		return m.conflict(ours, name, et, Conflict{p, ConflictDeleteModify})
+	case eo.mode().Type() != et.mode().Type():
+		return m.conflict(ours, name, et, Conflict{p, ConflictType})
+	case eo.dir != nil:
+		if err := m.mergeAttrs(eb, eo, et, p); err != nil {
+			return err
+		}
+		return m.mergeDir(eb.dir, eo.dir, et.dir, p)
+	}
+	return m.mergeFile(ours, name, eb, eo, et, p)
+}
+
+func (m *merger) mergeFile(ours *Tree, name string, eb, eo, et entry, p string) error {
+	oursChanged, theirsChanged := true, true
+	if eb.file != nil {
+		same, err := sameContents(eo.file, eb.file)
+		if err != nil {
+			return err
+		}
+		oursChanged = !same
+		if same, err = sameContents(et.file, eb.file); err != nil {
+			return err
+		}
+		theirsChanged = !same
+	}
+	same, err := sameContents(eo.file, et.file)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !theirsChanged || same:
+		// ours already has the merged contents
+	case !oursChanged:
+		if err := eo.file.replace(io.NewSectionReader(et.file.contents, 0, et.file.Size())); err != nil {
+			return err
+		}
+	default:
+		if merged, ok := m.mergeText(eb.file, eo.file, et.file); ok {
+			if err := eo.file.replace(strings.NewReader(merged)); err != nil {
+				return err
+			}
+			break
+		}
+		if m.resolve(Conflict{p, ConflictContent}) == TakeTheirs {
+			return m.take(ours, name, et, p)
+		}
+	}
+	return m.mergeAttrs(eb, eo, et, p)
+}
+
+// mergeAttrs merges the mode, ownership and extended attributes of an entry both sides kept
+func (m *merger) mergeAttrs(eb, eo, et entry, p string) error {
+	if sameAttrs(eo, et) || sameAttrs(et, eb) {
+		return nil
+	}
+	if !sameAttrs(eo, eb) && m.resolve(Conflict{p, ConflictMode}) != TakeTheirs {
+		return nil
+	}
+	n, src := eo.inode(), et.inode()
+	n.copyAttrs(src)
+	if n.uid == src.uid && n.gid == src.gid {
+		if eo.file != nil {
+			eo.file.changed(OpChmod)
+		} else {
+			eo.dir.changed(OpChmod)
+		}
+		return nil
+	}
+	if eo.file != nil {
+		return eo.file.setOwner(src.uid, src.gid)
+	}
+	return eo.dir.setOwner(src.uid, src.gid)
+}
+
+// resolve asks the policy to settle a conflict, recording it if it is left unresolved
+func (m *merger) resolve(c Conflict) Resolution {
+	r := Unresolved
+	if m.policy.Resolve != nil {
+		r = m.policy.Resolve(c)
+	}
+	if r == Unresolved {
+		m.conflicts = append(m.conflicts, c)
+	}
+	return r
+}
+
+// conflict settles a conflict over a whole entry
+func (m *merger) conflict(ours *Tree, name string, et entry, c Conflict) error {
+	if m.resolve(c) == TakeTheirs {
+		return m.take(ours, name, et, c.Path)
+	}
+	return nil
+}
+
+// take replaces our entry under name with a copy of theirs, or removes it if they have none.
+// Theirs is copied under a temporary name first and swapped in once complete, so our
+// entry is left as it was if the copy fails.
+func (m *merger) take(ours *Tree, name string, et entry, p string) error {
+	if !et.exists() {
+		if ours.entry(name).exists() {
+			ours.removeEntry(name)
+		}
+		return nil
+	}
+	tmp := ours.tempName(name)
+	var err error
+	if et.file != nil {
+		err = m.copier.copyFile(et.file, ours, tmp, p)
+	} else {
+		err = m.copier.copyDir(et.dir, ours, tmp, p)
+	}
+	if err != nil {
+		if ours.entry(tmp).exists() {
+			ours.removeEntry(tmp)
+		}
+		return err
+	}
+	if !ours.entry(name).exists() {
+		return ours.rename(tmp, ours, name, 0)
+	}
+	if err := ours.rename(tmp, ours, name, RenameExchange); err != nil {
+		return err
+	}
+	ours.removeEntry(tmp)
+	return nil
+}
+
+// tempName picks an unused name in the directory to build a replacement for name under
+func (t *Tree) tempName(name string) string {
+	for i := 0; ; i++ {
+		tmp := fmt.Sprintf(".%s.merge%d", name, i)
+		if !t.entry(tmp).exists() {
+			return tmp
+		}
+	}
+}
+
+// replace swaps the contents of the file for those read from r
+func (f *File) replace(r io.Reader) error {
+	f.mu.Lock()
+	err := f.truncate(0)
+	if err == nil {
+		_, err = f.fill(r)
+	}
+	f.mu.Unlock()
+	f.changed(OpWrite)
+	return err
+}
+
+// sameEntry compares entries by type, attributes and contents
+func sameEntry(a, b entry) (bool, error) {
+	if !a.exists() || !b.exists() {
+		return a.exists() == b.exists(), nil
+	}
+	if !sameAttrs(a, b) {
+		return false, nil
+	}
+	if a.file != nil {
+		return sameContents(a.file, b.file)
+	}
+	ha, err := a.dir.HashWith(diffHash)
+	if err != nil {
+		return false, err
+	}
+	hb, err := b.dir.HashWith(diffHash)
+	return ha == hb, err
+}
+
+// sameAttrs compares the mode, ownership and extended attributes of entries
+func sameAttrs(a, b entry) bool {
+	if !a.exists() || !b.exists() {
+		return a.exists() == b.exists()
+	}
+	return a.mode() == b.mode() && sameMeta(a.inode(), b.inode())
+}
+
+// mergeText merges two sets of changes to a text file, if the policy allows and they do not overlap
+func (m *merger) mergeText(base, ours, theirs *File) (string, bool) {
+	if !m.policy.TextMerge {
+		return "", false
+	}
+	texts := make([][]string, 3)
+	for i, f := range []*File{base, ours, theirs} {
+		text, ok := textContent(f)
+		if !ok {
+			return "", false
+		}
+		texts[i] = splitLines(text)
+	}
+	merged, ok := diff3(texts[0], texts[1], texts[2])
+	return strings.Join(merged, ""), ok
+}
+
+// splitLines splits text into lines, each keeping its newline
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matching maps each line of base to the line of other it is kept as, or -1.
+// It fails if the files are too different to compare.
+func matching(base, other []string) ([]int, bool) {
+	ops, ok := lineDiff(base, other)
+	if !ok {
+		return nil, false
+	}
+	m := make([]int, len(base))
+	for i := range m {
+		m[i] = -1
+	}
+	for _, op := range ops {
+		if op.kind == ' ' {
+			m[op.oldAt] = op.newAt
+		}
+	}
+	return m, true
+}
+
+// diff3 merges the changes a and b made to base, failing if they change the same lines
+// differently, or either side is too different from base to compare
+func diff3(base, a, b []string) ([]string, bool) {
+	ma, ok := matching(base, a)
+	if !ok {
+		return nil, false
+	}
+	mb, ok := matching(base, b)
+	if !ok {
+		return nil, false
+	}
+	merged := []string{}
+	i, j, k := 0, 0, 0
+	for i < len(base) || j < len(a) || k < len(b) {
+		if i < len(base) && ma[i] == j && mb[i] == k {
+			merged = append(merged, base[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+		// find where both sides next agree with base, and settle the changes before it
+		next := i
+		for next < len(base) && (ma[next] < 0 || mb[next] < 0) {
+			next++
+		}
+		nextA, nextB := len(a), len(b)
+		if next < len(base) {
+			nextA, nextB = ma[next], mb[next]
+		}
+		chunk, chunkA, chunkB := base[i:next], a[j:nextA], b[k:nextB]
+		switch {
+		case equalLines(chunkA, chunk):
+			merged = append(merged, chunkB...)
+		case equalLines(chunkB, chunk) || equalLines(chunkA, chunkB):
+			merged = append(merged, chunkA...)
+		default:
+			return nil, false
+		}
+		i, j, k = next, nextA, nextB
+	}
+	return merged, true
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package memphis
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff3(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, a, b    string
+		merged        string
+		wantConflicts bool
+	}{
+		{name: "unchanged", base: "1\n2\n", a: "1\n2\n", b: "1\n2\n", merged: "1\n2\n"},
+		{name: "separate edits", base: "1\n2\n3\n4\n5\n", a: "x\n2\n3\n4\n5\n", b: "1\n2\n3\n4\ny\n", merged: "x\n2\n3\n4\ny\n"},
+		{name: "adjacent edits", base: "1\n2\n3\n4\n", a: "1\nx\n3\n4\n", b: "1\n2\ny\n4\n", wantConflicts: true},
+		{name: "same edit", base: "1\n2\n3\n", a: "1\nx\n3\n", b: "1\nx\n3\n", merged: "1\nx\n3\n"},
+		{name: "delete and modify", base: "1\n2\n3\n", a: "1\n3\n", b: "1\nx\n3\n", wantConflicts: true},
+		{name: "delete only", base: "1\n2\n3\n", a: "1\n3\n", b: "1\n2\n3\n", merged: "1\n3\n"},
+		{name: "both append differently", base: "1\n", a: "1\na\n", b: "1\nb\n", wantConflicts: true},
+		{name: "both append the same", base: "1\n", a: "1\na\n", b: "1\na\n", merged: "1\na\n"},
+		{name: "append and edit", base: "1\n2\n", a: "1\n2\n3\n", b: "0\n2\n", merged: "0\n2\n3\n"},
+		{name: "edit before unterminated line", base: "1\n2", a: "x\n2", b: "1\n2", merged: "x\n2"},
+		{name: "terminate last line and edit", base: "1\n2\n3", a: "1\n2\n3\n", b: "x\n2\n3", merged: "x\n2\n3\n"},
+		{name: "terminate last line next to edit", base: "1\n2", a: "1\n2\n", b: "x\n2", wantConflicts: true},
+		{name: "both edit unterminated line", base: "1\n2", a: "1\n3", b: "1\n4", wantConflicts: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, ok := diff3(splitLines(tt.base), splitLines(tt.a), splitLines(tt.b))
+			if ok == tt.wantConflicts {
+				t.Fatalf("diff3 ok = %v, want %v", ok, !tt.wantConflicts)
+			}
+			if got := strings.Join(merged, ""); ok && got != tt.merged {
+				t.Errorf("diff3 = %q, want %q", got, tt.merged)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package memphis
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// overlayBlockSize is the granularity at which modified ranges of an overlay are held in memory
+const overlayBlockSize = 4096
+
+// overlayContents is a FileContent that reads unmodified ranges from an underlying
+// base, keeping only the blocks that have been written to in memory. Once the
+// blocks held in memory pass the spill options, the whole contents move to disk.
+type overlayContents struct {
+	sync.Mutex
+	base     FileContent
+	baseSize int64 // baseSize is the prefix of base that has not been truncated away
+	size     int64
+	blocks   map[int64][]byte
+	owner    *File
+	pristine bool       // pristine is set until the contents are first modified
+	spill    *spillFile // spill holds the contents once they have moved to disk
+}
+
+func newOverlay(base FileContent, owner *File) *overlayContents {
+	return &overlayContents{
+		base:     base,
+		baseSize: base.Size(),
+		size:     base.Size(),
+		blocks:   make(map[int64][]byte),
+		owner:    owner,
+		pristine: true,
+	}
+}
+
+func (o *overlayContents) Size() int64 {
+	o.Lock()
+	defer o.Unlock()
+	o.follow()
+	return o.size
+}
+
+// follow tracks the size of the base for as long as the contents are unmodified
+func (o *overlayContents) follow() {
+	if o.pristine {
+		o.size = o.base.Size()
+		o.baseSize = o.size
+	}
+}
+
+func (o *overlayContents) ReadAt(buf []byte, offset int64) (n int, err error) {
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.follow()
+	if o.spill != nil {
+		return o.spill.ReadAt(buf, offset)
+	}
+	return o.readAt(buf, offset)
+}
+
+// readAt reads the contents while they are held locked
+func (o *overlayContents) readAt(buf []byte, offset int64) (n int, err error) {
+	if offset >= o.size {
+		return 0, io.EOF
+	}
+
+	l := int64(len(buf))
+	if offset+l > o.size {
+		l = o.size - offset
+		err = io.EOF
+	}
+	for int64(n) < l {
+		pos := offset + int64(n)
+		chunk := o.chunk(pos, l-int64(n))
+		dst := buf[n : int64(n)+chunk]
+		if blk, ok := o.blocks[pos/overlayBlockSize]; ok {
+			copy(dst, blk[pos%overlayBlockSize:])
+		} else if rerr := o.readBase(dst, pos); rerr != nil {
+			return n, rerr
+		}
+		n += len(dst)
+	}
+	return n, err
+}
+
+func (o *overlayContents) WriteAt(p []byte, offset int64) (n int, err error) {
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.follow()
+	o.pristine = false
+	if o.spill == nil && o.spillDue(offset, int64(len(p))) {
+		if err := o.spillOut(); err != nil {
+			return 0, err
+		}
+	}
+	if o.spill != nil {
+		n, err = o.spill.WriteAt(p, offset)
+		o.size = o.spill.size
+		return n, err
+	}
+
+	for n < len(p) {
+		pos := offset + int64(n)
+		chunk := o.chunk(pos, int64(len(p)-n))
+		blk, err := o.block(pos / overlayBlockSize)
+		if err != nil {
+			return n, err
+		}
+		copy(blk[pos%overlayBlockSize:], p[n:int64(n)+chunk])
+		n += int(chunk)
+		if end := pos + chunk; end > o.size {
+			o.size = end
+		}
+	}
+	return n, nil
+}
+
+func (o *overlayContents) Truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.follow()
+	o.pristine = false
+	if o.spill != nil {
+		if err := o.spill.Truncate(size); err != nil {
+			return err
+		}
+		o.size = size
+		return nil
+	}
+
+	if size < o.baseSize {
+		o.baseSize = size
+	}
+	if size < o.size {
+		for idx, blk := range o.blocks {
+			start := idx * overlayBlockSize
+			if start >= size {
+				delete(o.blocks, idx)
+				o.owner.charge(-overlayBlockSize)
+			} else if start+overlayBlockSize > size {
+				zero(blk[size-start:])
+			}
+		}
+	}
+	o.size = size
+	return nil
+}
+
+// chunk is how many of the next remaining bytes starting at pos fall within a single block
+func (o *overlayContents) chunk(pos, remaining int64) int64 {
+	c := overlayBlockSize - pos%overlayBlockSize
+	if c > remaining {
+		c = remaining
+	}
+	return c
+}
+
+// block returns the in-memory copy of a block, copying it from the base if it is not yet dirty
+func (o *overlayContents) block(idx int64) ([]byte, error) {
+	if blk, ok := o.blocks[idx]; ok {
+		return blk, nil
+	}
+	if err := o.owner.charge(overlayBlockSize); err != nil {
+		return nil, err
+	}
+	blk := make([]byte, overlayBlockSize)
+	if err := o.readBase(blk, idx*overlayBlockSize); err != nil {
+		o.owner.charge(-overlayBlockSize)
+		return nil, err
+	}
+	o.blocks[idx] = blk
+	return blk, nil
+}
+
+// readBase fills buf with base contents at offset; ranges past the visible base read as zeros
+func (o *overlayContents) readBase(buf []byte, offset int64) error {
+	zero(buf)
+	if offset >= o.baseSize {
+		return nil
+	}
+	l := int64(len(buf))
+	if offset+l > o.baseSize {
+		l = o.baseSize - offset
+	}
+	n, err := o.base.ReadAt(buf[:l], offset)
+	if int64(n) < l && err != nil {
+		return err
+	}
+	return nil
+}
+
+// spillDue determines if writing length bytes at offset should move the contents to disk
+func (o *overlayContents) spillDue(offset, length int64) bool {
+	if o.owner == nil || o.owner.vol == nil || length == 0 {
+		return false
+	}
+	growth := int64(0)
+	for idx := offset / overlayBlockSize; idx <= (offset+length-1)/overlayBlockSize; idx++ {
+		if _, ok := o.blocks[idx]; !ok {
+			growth += overlayBlockSize
+		}
+	}
+	resident := int64(len(o.blocks))*overlayBlockSize + growth
+	return o.owner.vol.spillDue(resident, growth)
+}
+
+// spillOut moves the contents, base and dirty blocks alike, to a temporary file
+// a chunk at a time, and releases the blocks held in memory.
+func (o *overlayContents) spillOut() error {
+	vol := o.owner.vol
+	s, err := vol.newSpillFile()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, copyBuffer)
+	for off := int64(0); off < o.size; {
+		n, err := o.readAt(buf, off)
+		if n > 0 {
+			if _, werr := s.WriteAt(buf[:n], off); werr != nil {
+				vol.discard(s)
+				return werr
+			}
+			off += int64(n)
+		}
+		if err != nil && err != io.EOF {
+			vol.discard(s)
+			return err
+		}
+	}
+	if err := s.Truncate(o.size); err != nil {
+		vol.discard(s)
+		return err
+	}
+	o.spill = s
+	o.owner.charge(-int64(len(o.blocks)) * overlayBlockSize)
+	o.blocks = make(map[int64][]byte)
+	if base, ok := o.base.(*osFileContent); ok && base.vol != nil {
+		base.unpin()
+	}
+	return nil
+}
+
+func (o *overlayContents) resident() int64 {
+	o.Lock()
+	defer o.Unlock()
+	return int64(len(o.blocks)) * overlayBlockSize
+}
+
+func zero(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
@@ -0,0 +1,53 @@
+package memphis
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	data := strings.Repeat("a", 3*overlayBlockSize)
+	_, f, p := importFile(t, data)
+	o, ok := f.contents.(*overlayContents)
+	if !ok {
+		t.Fatalf("imported contents are %T, want an overlay", f.contents)
+	}
+	if _, err := o.WriteAt([]byte("bb"), overlayBlockSize+10); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.resident(); got != overlayBlockSize {
+		t.Errorf("%d bytes resident after a small write, want one block", got)
+	}
+	want := []byte(data)
+	copy(want[overlayBlockSize+10:], "bb")
+	if got := f.Bytes(); !bytes.Equal(got, want) {
+		t.Error("overlay does not merge the written block with the base")
+	}
+	if disk, _ := os.ReadFile(p); string(disk) != data {
+		t.Error("writing the overlay modified the file on disk")
+	}
+
+	if err := o.Truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	if got := o.resident(); got != 0 {
+		t.Errorf("%d bytes resident after truncating below the dirty block", got)
+	}
+	if got := string(f.Bytes()); got != data[:10] {
+		t.Errorf("truncated overlay = %q", got)
+	}
+}
+
+func TestOverlayQuota(t *testing.T) {
+	root, f, _ := importFile(t, strings.Repeat("a", 2*overlayBlockSize))
+	root.SetLimits(Limits{Total: Usage{Bytes: overlayBlockSize / 2}})
+	if _, err := f.contents.WriteAt([]byte("b"), 0); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("write past the limit = %v, want ErrNoSpace", err)
+	}
+	if got := f.Bytes()[0]; got != 'a' {
+		t.Errorf("failed write changed the contents to %q", got)
+	}
+}
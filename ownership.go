@@ -0,0 +1,55 @@
+package memphis
+
+import (
+	"os"
+)
+
+// GroupInheritance selects how new files and directories choose their group
+type GroupInheritance int
+
+const (
+	// GroupSysV gives new entries the creator's group, unless the parent directory
+	// is setgid, in which case they take its group and new directories are setgid too.
+	GroupSysV GroupInheritance = iota
+	// GroupBSD always gives new entries the group of their parent directory.
+	GroupBSD
+)
+
+// creatableModeBits are the mode bits a caller may request for a new file or directory
+const creatableModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// SetGroupInheritance sets how entries created in the tree this directory belongs to choose their group.
+func (t *Tree) SetGroupInheritance(g GroupInheritance) {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.groups = g
+}
+
+// newOwner determines the owner, group and mode of an entry that euid:egid creates
+// in the directory. The umask is not applied when the directory has a default ACL,
+// which takes its place.
+func (t *Tree) newOwner(euid, egid uint32, perm, umask os.FileMode, dir bool) (uint32, uint32, os.FileMode) {
+	mode := perm & creatableModeBits
+	if t.defaultACL == nil {
+		mode &^= umask & os.ModePerm
+	}
+
+	t.vol.Lock()
+	groups := t.vol.groups
+	t.vol.Unlock()
+
+	gid := egid
+	switch {
+	case groups == GroupBSD:
+		gid = t.gid
+	case t.mode&os.ModeSetgid != 0:
+		gid = t.gid
+		if dir {
+			mode |= os.ModeSetgid
+		}
+	}
+	if dir {
+		mode |= os.ModeDir
+	}
+	return euid, gid, mode
+}
@@ -0,0 +1,63 @@
+package memphis
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUmask(t *testing.T) {
+	root := New()
+	b := root.AsBillyFS(0, 0)
+	if old := b.SetUmask(0077); old != defaultUmask {
+		t.Errorf("SetUmask returned %v, want the default %v", old, defaultUmask)
+	}
+	f, err := b.OpenFile("f", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got := root.entry("f").file.mode.Perm(); got != 0600 {
+		t.Errorf("created file has mode %v, want 0600", got)
+	}
+	if err := b.MkdirAll("d", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if got := root.entry("d").dir.mode.Perm(); got != 0700 {
+		t.Errorf("created directory has mode %v, want 0700", got)
+	}
+}
+
+func TestGroupInheritance(t *testing.T) {
+	root := New()
+	sgid, err := root.CreateDir("sgid", 0, 50, 0777|os.ModeDir|os.ModeSetgid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := root.CreateDir("plain", 0, 50, 0777|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uid, gid, _ := plain.newOwner(7, 8, 0644, 0, false); uid != 7 || gid != 8 {
+		t.Errorf("SysV owner in a plain directory = %d:%d, want the creator's 7:8", uid, gid)
+	}
+	_, gid, mode := sgid.newOwner(7, 8, 0755, 0, true)
+	if gid != 50 || mode&os.ModeSetgid == 0 {
+		t.Errorf("directory in a setgid directory = gid %d, mode %v; want gid 50 and setgid", gid, mode)
+	}
+	if _, _, mode := sgid.newOwner(7, 8, 0644, 0, false); mode&os.ModeSetgid != 0 {
+		t.Error("a file created in a setgid directory was made setgid")
+	}
+
+	root.SetGroupInheritance(GroupBSD)
+	if _, gid, _ := plain.newOwner(7, 8, 0644, 0, false); gid != 50 {
+		t.Errorf("BSD group in a plain directory = %d, want the directory's 50", gid)
+	}
+	// inheritance does not let a user create in a directory it may not write
+	if _, err := root.CreateDir("locked", 0, 8, 0755|os.ModeDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.AsBillyFS(7, 8).OpenFile("locked/f", os.O_RDWR|os.O_CREATE, 0644); !os.IsPermission(err) {
+		t.Errorf("create in a read-only directory = %v, want ErrPermission", err)
+	}
+}
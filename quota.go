@@ -0,0 +1,208 @@
+package memphis
+
+// Usage is an amount of resources held by a tree or a user of it.
+type Usage struct {
+	Bytes  int64 // Bytes is the size of file contents held in memory
+	Inodes int64 // Inodes is the number of files and directories
+}
+
+// Limits bounds the resources a memphis tree may consume.
+// Zero values are treated as unlimited.
+type Limits struct {
+	Total      Usage            // Total bounds the tree as a whole
+	DirEntries int              // DirEntries bounds the number of entries in a single directory
+	PerUID     Usage            // PerUID is the default quota applied to each user
+	UIDs       map[uint32]Usage // UIDs overrides PerUID for specific users
+}
+
+// StatFS describes the limits and current usage of a tree
+type StatFS struct {
+	Limits Limits
+	Used   Usage
+	Users  map[uint32]Usage
+}
+
+// SetLimits configures the resource limits of the tree this directory belongs to.
+// Limits are not retroactive: existing usage above a new limit is kept, but
+// further growth fails.
+func (t *Tree) SetLimits(l Limits) {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.limits = l
+}
+
+// Statfs reports the limits and usage of the tree this directory belongs to.
+func (t *Tree) Statfs() StatFS {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	s := StatFS{
+		Limits: t.vol.limits,
+		Used:   t.vol.used,
+		Users:  make(map[uint32]Usage, len(t.vol.users)),
+	}
+	for uid, u := range t.vol.users {
+		s.Users[uid] = *u
+	}
+	return s
+}
+
+func exceeds(limit, used, delta int64) bool {
+	return limit > 0 && delta > 0 && used+delta > limit
+}
+
+func (l *Limits) forUID(uid uint32) Usage {
+	if q, ok := l.UIDs[uid]; ok {
+		return q
+	}
+	return l.PerUID
+}
+
+// charge records resources consumed on behalf of uid, failing if a limit would be exceeded.
+func (v *volume) charge(uid uint32, bytes, inodes int64) error {
+	v.Lock()
+	defer v.Unlock()
+	if exceeds(v.limits.Total.Bytes, v.used.Bytes, bytes) || exceeds(v.limits.Total.Inodes, v.used.Inodes, inodes) {
+		return ErrNoSpace
+	}
+	if err := v.checkQuota(uid, bytes, inodes); err != nil {
+		return err
+	}
+	v.record(uid, bytes, inodes)
+	return nil
+}
+
+// add records resources without enforcing limits, as for releases or content imported from disk.
+func (v *volume) add(uid uint32, bytes, inodes int64) {
+	v.Lock()
+	defer v.Unlock()
+	v.record(uid, bytes, inodes)
+}
+
+// transfer moves resources from one user to another, as on chown.
+func (v *volume) transfer(from, to uint32, bytes, inodes int64) error {
+	if from == to {
+		return nil
+	}
+	v.Lock()
+	defer v.Unlock()
+	if err := v.checkQuota(to, bytes, inodes); err != nil {
+		return err
+	}
+	v.record(from, -bytes, -inodes)
+	v.record(to, bytes, inodes)
+	return nil
+}
+
+func (v *volume) checkQuota(uid uint32, bytes, inodes int64) error {
+	var used Usage
+	if u, ok := v.users[uid]; ok {
+		used = *u
+	}
+	q := v.limits.forUID(uid)
+	if exceeds(q.Bytes, used.Bytes, bytes) || exceeds(q.Inodes, used.Inodes, inodes) {
+		return ErrQuota
+	}
+	return nil
+}
+
+func (v *volume) record(uid uint32, bytes, inodes int64) {
+	u, ok := v.users[uid]
+	if !ok {
+		u = &Usage{}
+		v.users[uid] = u
+	}
+	v.used.Bytes += bytes
+	v.used.Inodes += inodes
+	u.Bytes += bytes
+	u.Inodes += inodes
+	if u.Bytes == 0 && u.Inodes == 0 {
+		delete(v.users, uid)
+	}
+}
+
+// checkEntries verifies a new entry can be added to the directory
+func (t *Tree) checkEntries(name string) error {
+	if _, ok := t.files[name]; ok {
+		return nil
+	}
+	if _, ok := t.directories[name]; ok {
+		return nil
+	}
+	t.vol.Lock()
+	limit := t.vol.limits.DirEntries
+	t.vol.Unlock()
+	if limit > 0 && len(t.files)+len(t.directories) >= limit {
+		return ErrNoSpace
+	}
+	return nil
+}
+
+// charge implements accountant for the in-memory contents of a file
+func (f *File) charge(delta int64) error {
+	if f == nil || f.vol == nil {
+		return nil
+	}
+	if delta <= 0 {
+		f.vol.add(f.uid, delta, 0)
+		return nil
+	}
+	return f.vol.charge(f.uid, delta, 0)
+}
+
+// release returns the resources held by a file that is no longer linked into the tree.
+// If handles to the file are still open, this is deferred until they are closed.
+func (f *File) release() {
+	f.mu.Lock()
+	f.parent = nil
+	if f.opens > 0 {
+		f.unlinked = true
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+	f.free()
+}
+
+// free returns the resources held by an unlinked file
+func (f *File) free() {
+	if f.vol == nil {
+		return
+	}
+	f.vol.add(f.uid, -residentBytes(f.contents), -1)
+	discardContents(f.contents)
+}
+
+// release returns the resources held by a removed directory and everything beneath it
+func (t *Tree) release() {
+	for _, f := range t.files {
+		f.release()
+	}
+	for _, d := range t.directories {
+		d.release()
+	}
+	t.vol.add(t.uid, 0, -1)
+}
+
+// setOwner changes the owner of a file, moving its usage to the new user
+func (f *File) setOwner(uid, gid uint32) error {
+	if f.vol != nil {
+		if err := f.vol.transfer(f.uid, uid, residentBytes(f.contents), 1); err != nil {
+			return err
+		}
+	}
+	f.uid = uid
+	f.gid = gid
+	f.changed(OpChmod)
+	return nil
+}
+
+// setOwner changes the owner of a directory, moving its usage to the new user
+func (t *Tree) setOwner(uid, gid uint32) error {
+	if err := t.vol.transfer(t.uid, uid, 0, 1); err != nil {
+		return err
+	}
+	t.uid = uid
+	t.gid = gid
+	t.changed(OpChmod)
+	return nil
+}
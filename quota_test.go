@@ -0,0 +1,76 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	root := New()
+	root.SetLimits(Limits{
+		Total:      Usage{Bytes: 10},
+		PerUID:     Usage{Inodes: 2},
+		DirEntries: 3,
+	})
+	mustWrite(t, root, "a", "12345")
+	if got := root.Statfs().Used.Bytes; got != 5 {
+		t.Errorf("used %d bytes, want 5", got)
+	}
+	if u := root.Statfs().Users[0]; u.Bytes != 5 || u.Inodes != 2 {
+		t.Errorf("uid 0 used %+v, want 5 bytes and 2 inodes", u)
+	}
+
+	f, _ := root.Create("b", 1, 1, 0644)
+	if err := f.replace(strings.NewReader("1234567")); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("write beyond the total = %v, want ErrNoSpace", err)
+	}
+	if _, err := root.Create("c", 1, 1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Create("d", 1, 1, 0644); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("create beyond the directory limit = %v, want ErrNoSpace", err)
+	}
+	other := New()
+	other.SetLimits(Limits{PerUID: Usage{Inodes: 1}})
+	other.Create("one", 2, 2, 0644)
+	if _, err := other.Create("two", 2, 2, 0644); !errors.Is(err, ErrQuota) {
+		t.Errorf("create beyond the user's quota = %v, want ErrQuota", err)
+	}
+}
+
+func TestTruncateNegative(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	bf, err := root.AsBillyFS(0, 0).OpenFile("f", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bf.Close()
+	if err := bf.Truncate(-1); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Truncate(-1) = %v, want EINVAL", err)
+	}
+	if err := bf.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := root.Statfs().Used.Bytes; got != 2 {
+		t.Errorf("used %d bytes after truncating, want 2", got)
+	}
+}
+
+func TestImportSymlinkQuota(t *testing.T) {
+	dir := t.TempDir()
+	root := FromOS(dir)
+	root.Names()
+	root.SetLimits(Limits{Total: Usage{Bytes: 2}})
+	os.Symlink("a/long/target", filepath.Join(dir, "l"))
+	if err := root.Refresh(); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("refresh importing a symlink beyond the limit = %v, want ErrNoSpace", err)
+	}
+	if root.entry("l").exists() {
+		t.Error("symlink beyond the limit was imported")
+	}
+}
@@ -0,0 +1,155 @@
+package memphis
+
+import (
+	"os"
+)
+
+// Flags for Rename, matching the values of renameat2(2)
+const (
+	RenameNoReplace = 1 // RenameNoReplace fails if the target exists
+	RenameExchange  = 2 // RenameExchange atomically swaps the source and target, which must both exist
+)
+
+// entry is the file or directory found under a name in a directory
+type entry struct {
+	file *File
+	dir  *Tree
+}
+
+func (t *Tree) entry(name string) entry {
+	if f, ok := t.files[name]; ok {
+		return entry{file: f}
+	}
+	if d, ok := t.directories[name]; ok {
+		d.ready.Do(d.deferred)
+		return entry{dir: d}
+	}
+	return entry{}
+}
+
+func (e entry) exists() bool {
+	return e.file != nil || e.dir != nil
+}
+
+func (e entry) release() {
+	if e.file != nil {
+		e.file.release()
+	} else if e.dir != nil {
+		e.dir.release()
+	}
+}
+
+// detach removes the entry under name from the directory, without releasing it
+func (t *Tree) detach(name string) {
+	delete(t.files, name)
+	delete(t.directories, name)
+	t.indexRemove(name)
+}
+
+// attach places an entry in the directory under name
+func (t *Tree) attach(name string, e entry) {
+	now := t.vol.now()
+	if e.file != nil {
+		e.file.parent = t
+		e.file.name = name
+		e.file.updateTimes(OpRename, now)
+		t.files[name] = e.file
+	} else {
+		e.dir.parent = t
+		e.dir.name = name
+		e.dir.updateTimes(OpRename, now)
+		t.directories[name] = e.dir
+	}
+	t.indexAdd(name)
+}
+
+// within checks if the directory is d or one of its descendants
+func (t *Tree) within(d *Tree) bool {
+	for cur := t; cur != nil; cur = cur.parent {
+		if cur == d {
+			return true
+		}
+	}
+	return false
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".."
+}
+
+// Rename moves the entry oldName of the directory to newName in newParent, following rename(2).
+// An existing file at the target is replaced, as is an empty directory when moving a directory.
+// flags may request RenameNoReplace or RenameExchange behavior. As with rename(2) across
+// filesystems, newParent must belong to the same tree, or ErrCrossDevice is returned.
+func (t *Tree) Rename(oldName string, newParent *Tree, newName string, flags int) error {
+	return linkError("rename", oldName, newName, t.rename(oldName, newParent, newName, flags))
+}
+
+func (t *Tree) rename(oldName string, newParent *Tree, newName string, flags int) error {
+	if flags&^(RenameNoReplace|RenameExchange) != 0 || flags == RenameNoReplace|RenameExchange {
+		return os.ErrInvalid
+	}
+	if !validName(oldName) || !validName(newName) {
+		return os.ErrInvalid
+	}
+	if t.vol != newParent.vol {
+		return ErrCrossDevice
+	}
+	t.ready.Do(t.deferred)
+	newParent.ready.Do(newParent.deferred)
+
+	src := t.entry(oldName)
+	if !src.exists() {
+		return os.ErrNotExist
+	}
+	dst := newParent.entry(newName)
+	if src == dst {
+		return nil
+	}
+	if src.dir != nil && newParent.within(src.dir) {
+		return os.ErrInvalid
+	}
+
+	if flags&RenameExchange != 0 {
+		if !dst.exists() {
+			return os.ErrNotExist
+		}
+		if dst.dir != nil && t.within(dst.dir) {
+			return os.ErrInvalid
+		}
+		t.detach(oldName)
+		newParent.detach(newName)
+		newParent.attach(newName, src)
+		t.attach(oldName, dst)
+		t.entriesChanged()
+		newParent.entriesChanged()
+		t.notifyRename(OpCreate, oldName, newParent, newName)
+		newParent.notifyRename(OpCreate, newName, t, oldName)
+		return nil
+	}
+
+	if dst.exists() {
+		switch {
+		case flags&RenameNoReplace != 0:
+			return os.ErrExist
+		case src.file != nil && dst.dir != nil:
+			return ErrIsDir
+		case src.dir != nil && dst.file != nil:
+			return ErrNotDir
+		case dst.dir != nil && len(dst.dir.files)+len(dst.dir.directories) > 0:
+			return ErrNotEmpty
+		}
+	} else if err := newParent.checkEntries(newName); err != nil {
+		return err
+	}
+
+	t.detach(oldName)
+	newParent.detach(newName)
+	newParent.attach(newName, src)
+	dst.release()
+	t.entriesChanged()
+	newParent.entriesChanged()
+	t.notify(OpRename, oldName)
+	newParent.notifyRename(OpCreate, newName, t, oldName)
+	return nil
+}
@@ -0,0 +1,55 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "a", "one")
+	mustWrite(t, root, "b", "two")
+	sub, _ := root.CreateDir("sub", 0, 0, 0755)
+
+	if err := root.Rename("a", sub, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sub.files["c"]; !ok || root.entry("a").exists() {
+		t.Fatal("rename did not move the file")
+	}
+	if err := root.Rename("b", sub, "c", RenameNoReplace); !errors.Is(err, os.ErrExist) {
+		t.Errorf("RenameNoReplace over a file = %v, want ErrExist", err)
+	}
+	if err := root.Rename("b", sub, "c", RenameExchange); err != nil {
+		t.Fatal(err)
+	}
+	if string(sub.files["c"].Bytes()) != "two" || string(root.files["b"].Bytes()) != "one" {
+		t.Error("RenameExchange did not swap the files")
+	}
+	if err := root.Rename("missing", root, "x", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rename of a missing entry = %v, want ErrNotExist", err)
+	}
+	if err := root.Rename("sub", sub, "loop", 0); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("rename into itself = %v, want EINVAL", err)
+	}
+}
+
+func TestRenameAcrossTrees(t *testing.T) {
+	x, y := New(), New()
+	mustWrite(t, x, "f", "hello")
+	before := x.Statfs().Used
+
+	err := x.Rename("f", y, "g", 0)
+	var le *os.LinkError
+	if !errors.As(err, &le) || !errors.Is(err, ErrCrossDevice) {
+		t.Fatalf("rename across trees = %v, want a link error with ErrCrossDevice", err)
+	}
+	if !x.entry("f").exists() || y.entry("g").exists() {
+		t.Error("failed rename moved the entry")
+	}
+	if x.Statfs().Used != before {
+		t.Error("failed rename changed usage")
+	}
+}
@@ -0,0 +1,167 @@
+package memphis
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// Flags for Resolve, following openat2(2)
+const (
+	ResolveNoFollow = 1 << iota // ResolveNoFollow does not follow a symlink in the final component, as O_NOFOLLOW
+	ResolveBeneath              // ResolveBeneath fails with ErrCrossDevice if resolution would leave the starting directory
+	ResolveInRoot               // ResolveInRoot treats the starting directory as the root, confining absolute paths, symlinks and '..'
+)
+
+// maxSymlinks is how many symlinks may be followed resolving a single path
+const maxSymlinks = 40
+
+// resolved is the outcome of resolving a path. When only the final component is
+// missing, parent and name are still set so it can be created.
+type resolved struct {
+	parent  *Tree
+	name    string
+	file    *File
+	dir     *Tree
+	dirOnly bool // dirOnly is set when a trailing slash requires the path to be a directory
+}
+
+func (r resolved) exists() bool {
+	return r.file != nil || r.dir != nil
+}
+
+// splitPath separates a path into the components that need to be looked up,
+// and whether it ends in a way that requires a directory.
+func splitPath(p string) ([]string, bool) {
+	parts := []string{}
+	for _, s := range strings.Split(p, Separator) {
+		if s != "" && s != "." {
+			parts = append(parts, s)
+		}
+	}
+	trailing := strings.HasSuffix(p, Separator) || p == "." || strings.HasSuffix(p, "/.")
+	return parts, trailing
+}
+
+// top finds the root directory of the tree the directory belongs to
+func (t *Tree) top() *Tree {
+	for t.parent != nil {
+		t = t.parent
+	}
+	return t
+}
+
+// Resolve looks up a path relative to the directory, following symlinks as path_resolution(7).
+// Absolute paths and symlinks start from the root of the tree, unless ResolveInRoot makes the directory the root.
+func (t *Tree) Resolve(p string, flags int) (*File, *Tree, error) {
+	root := t.top()
+	if flags&ResolveInRoot != 0 {
+		root = t
+	}
+	r, err := t.lookup(root, p, flags)
+	if err != nil {
+		return nil, nil, pathError("resolve", p, err)
+	}
+	if !r.exists() {
+		return nil, nil, pathError("resolve", p, os.ErrNotExist)
+	}
+	return r.file, r.dir, nil
+}
+
+// lookup resolves a path starting from the directory. root is where absolute paths
+// begin and '..' stops. Up to maxSymlinks symlinks are followed before failing with ErrLoop.
+func (t *Tree) lookup(root *Tree, p string, flags int) (resolved, error) {
+	return t.lookupAs(root, p, flags, nil)
+}
+
+// lookupAs resolves a path as lookup, calling search on every directory a name is
+// looked up in, so front ends can require search permission on them.
+func (t *Tree) lookupAs(root *Tree, p string, flags int, search func(*Tree) error) (resolved, error) {
+	cur := t
+	parts, trailing := splitPath(p)
+	if path.IsAbs(p) {
+		if flags&ResolveBeneath != 0 {
+			return resolved{}, ErrCrossDevice
+		}
+		cur = root
+	}
+
+	links := 0
+	for len(parts) > 0 {
+		name := parts[0]
+		parts = parts[1:]
+		last := len(parts) == 0
+		cur.ready.Do(cur.deferred)
+		if search != nil {
+			if err := search(cur); err != nil {
+				return resolved{}, err
+			}
+		}
+
+		if name == ".." {
+			if cur == t && flags&ResolveBeneath != 0 {
+				return resolved{}, ErrCrossDevice
+			}
+			if cur != root && cur.parent != nil {
+				cur = cur.parent
+			}
+			continue
+		}
+		if d, ok := cur.directories[name]; ok {
+			if last {
+				d.ready.Do(d.deferred)
+				return resolved{parent: cur, name: name, dir: d, dirOnly: trailing}, nil
+			}
+			cur = d
+			continue
+		}
+		f, ok := cur.files[name]
+		if !ok {
+			if last {
+				return resolved{parent: cur, name: name, dirOnly: trailing}, nil
+			}
+			return resolved{}, os.ErrNotExist
+		}
+		if f.mode&os.ModeSymlink != 0 && (!last || trailing || flags&ResolveNoFollow == 0) {
+			links++
+			if links > maxSymlinks {
+				return resolved{}, ErrLoop
+			}
+			target := string(f.Bytes())
+			if target == "" {
+				return resolved{}, os.ErrNotExist
+			}
+			targetParts, targetTrailing := splitPath(target)
+			if path.IsAbs(target) {
+				if flags&ResolveBeneath != 0 {
+					return resolved{}, ErrCrossDevice
+				}
+				cur = root
+			}
+			if last {
+				trailing = trailing || targetTrailing
+			}
+			parts = append(targetParts, parts...)
+			continue
+		}
+		if !last || trailing {
+			return resolved{}, ErrNotDir
+		}
+		return resolved{parent: cur, name: name, file: f}, nil
+	}
+
+	cur.ready.Do(cur.deferred)
+	if cur == root {
+		return resolved{dir: cur, dirOnly: true}, nil
+	}
+	return resolved{parent: cur.parent, name: cur.name, dir: cur, dirOnly: true}, nil
+}
+
+// pathFrom finds the path of the directory relative to root
+func (t *Tree) pathFrom(root *Tree) string {
+	parts := []string{}
+	for cur := t; cur != root && cur != nil; cur = cur.parent {
+		parts = append([]string{cur.name}, parts...)
+	}
+	return strings.Join(parts, Separator)
+}
@@ -0,0 +1,82 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// resolveTree builds a tree with a directory holding a file, and symlinks to both
+func resolveTree(t *testing.T) *Tree {
+	t.Helper()
+	root := New()
+	d, err := root.CreateDir("d", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, d, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	for target, link := range map[string]string{
+		"d/f":  "rel",
+		"/d":   "d/abs",
+		"loop": "loop",
+		"../d": "d/up",
+	} {
+		if err := b.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestResolve(t *testing.T) {
+	root := resolveTree(t)
+	d := root.entry("d").dir
+	if f, _, err := root.Resolve("rel", 0); err != nil || f != d.entry("f").file {
+		t.Errorf("Resolve through a relative link = %v, %v", f, err)
+	}
+	if f, _, err := d.Resolve("abs/f", 0); err != nil || f != d.entry("f").file {
+		t.Errorf("Resolve through an absolute link = %v, %v", f, err)
+	}
+	if f, _, err := d.Resolve("up/f", 0); err != nil || f != d.entry("f").file {
+		t.Errorf("Resolve through a link to .. = %v, %v", f, err)
+	}
+	if f, _, err := root.Resolve("rel", ResolveNoFollow); err != nil || f.mode&os.ModeSymlink == 0 {
+		t.Errorf("Resolve with ResolveNoFollow = %v, %v, want the link", f, err)
+	}
+	// in root, '..' and absolute paths stay within the starting directory
+	if _, dir, err := d.Resolve("../../", ResolveInRoot); err != nil || dir != d {
+		t.Errorf("Resolve of .. in root = %v, %v", dir, err)
+	}
+	if f, _, err := d.Resolve("/f", ResolveInRoot); err != nil || f != d.entry("f").file {
+		t.Errorf("Resolve of an absolute path in root = %v, %v", f, err)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	root := resolveTree(t)
+	d := root.entry("d").dir
+	for _, c := range []struct {
+		dir   *Tree
+		path  string
+		flags int
+		want  error
+	}{
+		{root, "loop", 0, ErrLoop},
+		{root, "d/f/", 0, ErrNotDir},
+		{root, "d/f/g", 0, ErrNotDir},
+		{root, "d/missing/g", 0, os.ErrNotExist},
+		{d, "..", ResolveBeneath, ErrCrossDevice},
+		{d, "abs", ResolveBeneath, ErrCrossDevice},
+		{d, "up", ResolveBeneath, ErrCrossDevice},
+		{d, "/d", ResolveBeneath, ErrCrossDevice},
+	} {
+		_, _, err := c.dir.Resolve(c.path, c.flags)
+		if !errors.Is(err, c.want) {
+			t.Errorf("Resolve(%q, %d) = %v, want %v", c.path, c.flags, err, c.want)
+		}
+		if _, ok := err.(*os.PathError); !ok {
+			t.Errorf("Resolve(%q) failed with %T, want a path error", c.path, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package memphis
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"os"
@@ -12,7 +13,58 @@ import (
 
 // Placer conforms a memphis directory tree to the rio FS interface
 type Placer struct {
-	root *Tree
+	euid  uint32      // euid is the user new files are created as
+	egid  uint32      // egid is the group new files are created as, subject to group inheritance
+	umask os.FileMode // umask is removed from the permissions of new files
+	root  *Tree
+}
+
+// AsPlacer provides a rio-compatible view of the current memphis directory tree.
+// The placer creates files as euid:egid, and has no umask, since rio sets
+// permissions explicitly.
+func (t *Tree) AsPlacer(euid, egid uint32) *Placer {
+	return &Placer{
+		euid: euid,
+		egid: egid,
+		root: t,
+	}
+}
+
+// SetUmask sets the umask applied to files and directories created through the
+// placer, returning the previous value.
+func (p *Placer) SetUmask(mask os.FileMode) os.FileMode {
+	old := p.umask
+	p.umask = mask & os.ModePerm
+	return old
+}
+
+// resolve looks up a path, with the root of the placer as the root for absolute paths and symlinks
+func (p *Placer) resolve(name string, flags int) (resolved, error) {
+	return p.root.lookupAs(p.root, name, flags, p.search)
+}
+
+// get finds the file or directory at a path
+func (p *Placer) get(path fs.RelPath, followSymlinks bool) (*File, *Tree, error) {
+	flags := 0
+	if !followSymlinks {
+		flags = ResolveNoFollow
+	}
+	r, err := p.resolve(path.String(), flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !r.exists() {
+		return nil, nil, os.ErrNotExist
+	}
+	return r.file, r.dir, nil
+}
+
+// search checks the placer may look up names in a directory
+func (p *Placer) search(d *Tree) error {
+	if !d.allows(p.euid, p.egid, AccessExec) {
+		return os.ErrPermission
+	}
+	return nil
 }
 
 // BasePath is the root of this FS - always '/'
@@ -20,16 +72,52 @@ func (p *Placer) BasePath() fs.AbsolutePath {
 	return fs.MustAbsolutePath(Separator)
 }
 
-// OpenFile attempts to open a file
+// OpenFile attempts to open a file, creating it if O_CREATE is set
 func (p *Placer) OpenFile(path fs.RelPath, flag int, perms fs.Perms) (fs.File, error) {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
+	f, err := p.openFile(path, flag, perms)
+	if err != nil {
+		return nil, pathError("open", path.String(), err)
+	}
+	return f, nil
+}
+
+func (p *Placer) openFile(path fs.RelPath, flag int, perms fs.Perms) (*BillyFile, error) {
+	flags := 0
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		flags = ResolveNoFollow
+	}
+	r, err := p.resolve(path.String(), flags)
 	if err != nil {
 		return nil, err
 	}
-	if d != nil {
+	if r.dir != nil {
+		return nil, ErrIsDir
+	}
+	f := r.file
+	if f == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		uid, gid, mode := r.parent.newOwner(p.euid, p.egid, permsToOs(perms), p.umask, false)
+		f, err := r.parent.Create(r.name, uid, gid, mode)
+		if err != nil {
+			return nil, err
+		}
+		return openHandle(f, flag), nil
+	}
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
 		return nil, os.ErrExist
 	}
-	return &BillyFile{f, 0}, nil
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.mu.Lock()
+		err := f.truncate(0)
+		f.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		f.changed(OpWrite)
+	}
+	return openHandle(f, flag), nil
 }
 
 func permsToOs(perms fs.Perms) (mode os.FileMode) {
@@ -62,154 +150,147 @@ func modeToPerms(mode os.FileMode) (perms fs.Perms) {
 
 // Mkdir makes a directory at path
 func (p *Placer) Mkdir(path fs.RelPath, perms fs.Perms) error {
-	parent := p.root.WalkDir(strings.Split(path.Dir().String(), Separator))
-	if parent == nil {
-		return os.ErrNotExist
-	}
-	fname := path.Last()
-	if _, ok := parent.files[fname]; ok {
-		return os.ErrExist
-	}
-	if _, ok := parent.directories[fname]; ok {
-		return os.ErrExist
+	r, err := p.resolve(path.String(), ResolveNoFollow)
+	if err != nil {
+		return pathError("mkdir", path.String(), err)
 	}
-	// todo: perms
-
-	dir := parent.CreateDir(fname, parent.uid, parent.gid, permsToOs(perms)|os.ModeDir)
-	if dir == nil {
-		return os.ErrInvalid
+	if r.exists() || r.parent == nil {
+		return pathError("mkdir", path.String(), os.ErrExist)
 	}
-	return nil
+	uid, gid, mode := r.parent.newOwner(p.euid, p.egid, permsToOs(perms), p.umask, true)
+	_, err = r.parent.CreateDir(r.name, uid, gid, mode)
+	return pathError("mkdir", path.String(), err)
 }
 
 // Mklink makes a symlink at path
 func (p *Placer) Mklink(path fs.RelPath, target string) error {
-	f, err := p.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
-	if err != nil {
-		return err
-	}
-	bf := f.(*BillyFile)
-	bf.Write([]byte(target))
-	bf.File.mode |= os.ModeSymlink
-	return nil
+	return linkError("symlink", target, path.String(), p.mknod(path, os.ModeSymlink, 0777, []byte(target)))
 }
 
 // Mkfifo makes a fifo node at path
 func (p *Placer) Mkfifo(path fs.RelPath, perms fs.Perms) error {
-	f, err := p.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perms)
-	if err != nil {
-		return err
-	}
-	bf := f.(*BillyFile)
-	bf.Write([]byte{})
-	bf.File.mode |= os.ModeNamedPipe
-	return nil
+	return pathError("mknod", path.String(), p.mknod(path, os.ModeNamedPipe, perms, nil))
 }
 
 // MkdevBlock makes a block device at path
 func (p *Placer) MkdevBlock(path fs.RelPath, major int64, minor int64, perms fs.Perms) error {
-	f, err := p.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perms)
-	if err != nil {
-		return err
-	}
-	bf := f.(*BillyFile)
-	buf := [16]byte{}
-	binary.LittleEndian.PutUint64(buf[0:8], uint64(major))
-	binary.LittleEndian.PutUint64(buf[8:16], uint64(minor))
-	bf.Write(buf[:])
-	bf.File.mode |= os.ModeDevice
-	return nil
+	return pathError("mknod", path.String(), p.mknod(path, os.ModeDevice, perms, devNumbers(major, minor)))
 }
 
 // MkdevChar makes a character device at path
 func (p *Placer) MkdevChar(path fs.RelPath, major int64, minor int64, perms fs.Perms) error {
-	f, err := p.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perms)
+	return pathError("mknod", path.String(), p.mknod(path, os.ModeCharDevice, perms, devNumbers(major, minor)))
+}
+
+// devNumbers encodes the numbers of a device node as its contents
+func devNumbers(major, minor int64) []byte {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(major))
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(minor))
+	return buf
+}
+
+// mknod creates a node of type typ at path, holding data. As with mknod(2) and symlink(2),
+// the final component is not followed, so any existing entry fails with ErrExist.
+func (p *Placer) mknod(path fs.RelPath, typ os.FileMode, perms fs.Perms, data []byte) error {
+	r, err := p.resolve(path.String(), ResolveNoFollow)
 	if err != nil {
 		return err
 	}
-	bf := f.(*BillyFile)
-	buf := [16]byte{}
-	binary.LittleEndian.PutUint64(buf[0:8], uint64(major))
-	binary.LittleEndian.PutUint64(buf[8:16], uint64(minor))
-	bf.Write(buf[:])
-	bf.File.mode |= os.ModeCharDevice
+	if r.exists() || r.parent == nil {
+		return os.ErrExist
+	}
+	uid, gid, mode := r.parent.newOwner(p.euid, p.egid, permsToOs(perms), p.umask, false)
+	f, err := r.parent.Create(r.name, uid, gid, mode|typ)
+	if err != nil {
+		return err
+	}
+	if _, err := f.fill(bytes.NewReader(data)); err != nil {
+		r.parent.removeEntry(r.name)
+		return err
+	}
 	return nil
 }
 
 // Lchown sets ownership of path w/o following symlinks
 func (p *Placer) Lchown(path fs.RelPath, uid uint32, gid uint32) error {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), false)
+	f, d, err := p.get(path, false)
 	if err != nil {
-		return err
+		return pathError("lchown", path.String(), err)
 	}
 
 	if f != nil {
-		f.uid = uid
-		f.gid = gid
-	} else if d != nil {
-		d.uid = uid
-		d.gid = gid
+		return pathError("lchown", path.String(), f.setOwner(uid, gid))
 	}
-	return nil
+	return pathError("lchown", path.String(), d.setOwner(uid, gid))
 }
 
 const nonPermModeBits = ^(os.ModePerm | os.ModeSetgid | os.ModeSetuid | os.ModeSticky)
 
 // Chmod sets permissions of path
 func (p *Placer) Chmod(path fs.RelPath, perms fs.Perms) error {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
+	f, d, err := p.get(path, true)
 	if err != nil {
-		return err
+		return pathError("chmod", path.String(), err)
 	}
 
 	mode := permsToOs(perms)
 	if f != nil {
 		f.mode = (f.mode & nonPermModeBits) | mode
+		f.syncACL()
+		f.changed(OpChmod)
 	} else if d != nil {
 		d.mode = (d.mode & nonPermModeBits) | mode
+		d.syncACL()
+		d.changed(OpChmod)
 	}
 	return nil
 }
 
 // SetTimesLNano sets modification/access times of path
 func (p *Placer) SetTimesLNano(path fs.RelPath, mtime time.Time, atime time.Time) error {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), false)
+	f, d, err := p.get(path, false)
 	if err != nil {
-		return err
+		return pathError("chtimes", path.String(), err)
 	}
 
 	if f != nil {
-		f.modTime = mtime
+		f.setTimes(atime, mtime)
+		f.changed(OpChmod)
 	} else {
-		d.modTime = mtime
+		d.setTimes(atime, mtime)
+		d.changed(OpChmod)
 	}
 	return nil
 }
 
 // SetTimesNano sets modification/access times of path
 func (p *Placer) SetTimesNano(path fs.RelPath, mtime time.Time, atime time.Time) error {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
+	f, d, err := p.get(path, true)
 	if err != nil {
-		return err
+		return pathError("chtimes", path.String(), err)
 	}
 
 	if f != nil {
-		f.modTime = mtime
+		f.setTimes(atime, mtime)
+		f.changed(OpChmod)
 	} else {
-		d.modTime = mtime
+		d.setTimes(atime, mtime)
+		d.changed(OpChmod)
 	}
 	return nil
 }
 
 func toMetadata(f *File) *fs.Metadata {
 	md := &fs.Metadata{
-		Name:  fs.MustRelPath(f.Name()),
-		Type:  fs.Type_File,
-		Perms: modeToPerms(f.Mode()),
-		Uid:   f.uid,
-		Gid:   f.gid,
-		Size:  f.Size(),
-		Mtime: f.ModTime(),
+		Name:   fs.MustRelPath(f.Name()),
+		Type:   fs.Type_File,
+		Perms:  modeToPerms(f.Mode()),
+		Uid:    f.uid,
+		Gid:    f.gid,
+		Size:   f.Size(),
+		Mtime:  f.ModTime(),
+		Xattrs: xattrNodeOf(f, nil).strings(),
 	}
 
 	if f.mode&os.ModeSymlink != 0 {
@@ -223,9 +304,7 @@ func toMetadata(f *File) *fs.Metadata {
 		} else {
 			md.Type = fs.Type_Device
 		}
-		b := f.Bytes()
-		md.Devmajor = int64(binary.LittleEndian.Uint64(b[0:8]))
-		md.Devminor = int64(binary.LittleEndian.Uint64(b[8:16]))
+		md.Devmajor, md.Devminor = f.deviceNumbers()
 	}
 
 	if f.mode&os.ModeNamedPipe != 0 {
@@ -237,21 +316,22 @@ func toMetadata(f *File) *fs.Metadata {
 
 func dirMetadata(path fs.RelPath, d *Tree) *fs.Metadata {
 	return &fs.Metadata{
-		Name:  path,
-		Type:  fs.Type_Dir,
-		Perms: modeToPerms(d.mode),
-		Uid:   d.uid,
-		Gid:   d.gid,
-		Size:  0,
-		Mtime: d.modTime,
+		Name:   path,
+		Type:   fs.Type_Dir,
+		Perms:  modeToPerms(d.mode),
+		Uid:    d.uid,
+		Gid:    d.gid,
+		Size:   0,
+		Mtime:  d.modTime,
+		Xattrs: xattrNodeOf(nil, d).strings(),
 	}
 }
 
 // Stat returns file metadata
 func (p *Placer) Stat(path fs.RelPath) (*fs.Metadata, error) {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
+	f, d, err := p.get(path, true)
 	if err != nil {
-		return nil, err
+		return nil, pathError("stat", path.String(), err)
 	}
 
 	if f != nil {
@@ -262,9 +342,9 @@ func (p *Placer) Stat(path fs.RelPath) (*fs.Metadata, error) {
 
 // LStat returns file metadata not following symlinks
 func (p *Placer) LStat(path fs.RelPath) (*fs.Metadata, error) {
-	f, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
+	f, d, err := p.get(path, false)
 	if err != nil {
-		return nil, err
+		return nil, pathError("lstat", path.String(), err)
 	}
 
 	if f != nil {
@@ -273,91 +353,48 @@ func (p *Placer) LStat(path fs.RelPath) (*fs.Metadata, error) {
 	return dirMetadata(path, d), nil
 }
 
-// ReadDirNames lists files in a directory
+// ReadDirNames lists files in a directory, sorted by name
 func (p *Placer) ReadDirNames(path fs.RelPath) ([]string, error) {
-	_, d, err := p.root.Get(strings.Split(path.String(), Separator), true)
-	if err != nil {
-		return nil, err
+	_, d, err := p.get(path, true)
+	if err == nil && d == nil {
+		err = ErrNotDir
 	}
-	if d == nil {
-		return nil, os.ErrExist
-	}
-	names := make([]string, 0, len(d.directories)+len(d.files))
-	for dn := range d.directories {
-		names = append(names, dn)
-	}
-	for fn := range d.files {
-		names = append(names, fn)
+	if err != nil {
+		return nil, pathError("open", path.String(), err)
 	}
-	return names, nil
+	return d.Names(), nil
 }
 
 // Readlink reads a symlink
 func (p *Placer) Readlink(path fs.RelPath) (target string, isSymlink bool, err error) {
-	f, _, err := p.root.Get(strings.Split(path.String(), Separator), false)
+	f, _, err := p.get(path, false)
 	if err != nil {
-		return "", false, err
-	}
-	if f == nil {
-		return "", false, os.ErrExist
+		return "", false, pathError("readlink", path.String(), err)
 	}
-	if f.mode&os.ModeSymlink == 0 {
+	if f == nil || f.mode&os.ModeSymlink == 0 {
 		return "", false, nil
 	}
 	return string(f.Bytes()), true, nil
 }
 
-// ResolveLink resolves a symlink
+// ResolveLink resolves a symlink found at startingAt, returning the path it leads to
 func (p *Placer) ResolveLink(symlink string, startingAt fs.RelPath) (fs.RelPath, error) {
 	if startingAt.GoesUp() {
 		return startingAt, fmt.Errorf("%s", fs.ErrBreakout)
 	}
-	return p.resolveLink(symlink, startingAt, map[fs.RelPath]struct{}{})
-}
-
-func (p *Placer) resolveLink(symlink string, startingAt fs.RelPath, seen map[fs.RelPath]struct{}) (fs.RelPath, error) {
-	if _, isSeen := seen[startingAt]; isSeen {
+	dir := p.root.WalkDir(strings.Split(startingAt.Dir().String(), Separator))
+	if dir == nil {
+		return startingAt, fs.NormalizeIOError(os.ErrNotExist)
+	}
+	r, err := dir.lookupAs(p.root, symlink, 0, p.search)
+	if err == ErrLoop {
 		return startingAt, fmt.Errorf("%s", fs.ErrRecursion)
 	}
-	seen[startingAt] = struct{}{}
-	segments := strings.Split(symlink, "/")
-	path := startingAt
-	if segments[0] == "" { // rooted
-		path = fs.RelPath{}
-		segments = segments[1:]
-	} else {
-		path = startingAt.Dir() // drop the link node itself
+	if err != nil {
+		return startingAt, fs.NormalizeIOError(err)
 	}
-	iLast := len(segments) - 1
-	for i, s := range segments {
-		// Identity segments can simply be skipped.
-		if s == "" || s == "." {
-			continue
-		}
-		// Excessive up segements aren't an error; they simply no-op when already at root.
-		if s == ".." && path == (fs.RelPath{}) {
-			continue
-		}
-		// Okay, join the segment and peek at it.
-		path = path.Join(fs.MustRelPath(s))
-		// Bail on cycles before considering recursion!
-		if path == startingAt {
-			return startingAt, fmt.Errorf("%s", fs.ErrRecursion)
-		}
-		// Check if this is a symlink; if so we must recurse on it.
-		morelink, isLink, err := p.Readlink(fs.MustRelPath(p.BasePath().Join(path).String()))
-		if err != nil {
-			if i == iLast && os.IsNotExist(err) {
-				return path, nil
-			}
-			return startingAt, fs.NormalizeIOError(err)
-		}
-		if isLink {
-			path, err = p.resolveLink(morelink, path, seen)
-			if err != nil {
-				return startingAt, err
-			}
-		}
+	if r.parent == nil {
+		return fs.RelPath{}, nil
 	}
-	return path, nil
+	return fs.MustRelPath(r.parent.pathFrom(p.root)).Join(fs.MustRelPath(r.name)), nil
 }
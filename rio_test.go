@@ -0,0 +1,62 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/polydawn/rio/fs"
+)
+
+func TestPlacerMklink(t *testing.T) {
+	root := New()
+	p := root.AsPlacer(0, 0)
+	if err := p.Mklink(fs.MustRelPath("link"), "target"); err != nil {
+		t.Fatal(err)
+	}
+	target, isLink, err := p.Readlink(fs.MustRelPath("link"))
+	if err != nil || !isLink || target != "target" {
+		t.Fatalf("Readlink = %q, %v, %v", target, isLink, err)
+	}
+	if err := p.MkdevChar(fs.MustRelPath("null"), 1, 3, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := p.LStat(fs.MustRelPath("null")); err != nil || m.Type != fs.Type_CharDevice {
+		t.Errorf("LStat of a char device = %v, %v", m, err)
+	}
+}
+
+func TestPlacerMklinkExisting(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "reg", "data")
+	p := root.AsPlacer(0, 0)
+	p.Mklink(fs.MustRelPath("dangling"), "reg2")
+
+	for _, name := range []string{"reg", "dangling"} {
+		err := p.Mklink(fs.MustRelPath(name), "elsewhere")
+		if !errors.Is(err, os.ErrExist) {
+			t.Errorf("Mklink over %s = %v, want ErrExist", name, err)
+		}
+		if err := p.Mkfifo(fs.MustRelPath(name), 0644); !errors.Is(err, os.ErrExist) {
+			t.Errorf("Mkfifo over %s = %v, want ErrExist", name, err)
+		}
+	}
+	if f := root.files["reg"]; f.mode&os.ModeType != 0 || string(f.Bytes()) != "data" {
+		t.Error("Mklink changed an existing file")
+	}
+	if root.entry("reg2").exists() {
+		t.Error("Mklink followed a symlink to create its target")
+	}
+}
+
+func TestPlacerMklinkQuota(t *testing.T) {
+	root := New()
+	root.SetLimits(Limits{Total: Usage{Bytes: 4}})
+	p := root.AsPlacer(0, 0)
+	if err := p.Mklink(fs.MustRelPath("link"), "a/long/target"); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Mklink beyond the quota = %v, want ErrNoSpace", err)
+	}
+	if root.entry("link").exists() {
+		t.Error("failed Mklink left an entry")
+	}
+}
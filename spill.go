@@ -0,0 +1,187 @@
+package memphis
+
+import (
+	"io"
+	"os"
+)
+
+// SpillOptions configures when in-memory file contents are moved to temporary files on disk.
+// Zero values disable the corresponding trigger.
+type SpillOptions struct {
+	Dir         string // Dir holds spilled contents; the OS temp directory is used if empty
+	Threshold   int64  // Threshold is the file size above which contents are spilled
+	MemoryLimit int64  // MemoryLimit spills files that grow while the tree holds more than this in memory
+}
+
+// SetSpill configures spilling of large files for the tree this directory belongs to.
+// Files already in memory are spilled the next time they grow.
+func (t *Tree) SetSpill(o SpillOptions) {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.spillOpts = o
+}
+
+// Close disposes of the tree, removing any temporary files backing spilled contents
+// and closing the descriptors it caches or holds for snapshots. Spilled files are no
+// longer readable after the tree is closed. Descriptors still in use by a read are
+// closed when it finishes.
+func (t *Tree) Close() error {
+	t.vol.Lock()
+	spilled := t.vol.spilled
+	t.vol.spilled = make(map[*spillFile]struct{})
+	t.vol.Unlock()
+
+	t.vol.fds.flush()
+
+	var firstErr error
+	for s := range spilled {
+		if err := s.remove(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// spillFile is a temporary file holding the contents of a memoryContents or overlayContents
+type spillFile struct {
+	*os.File
+	size int64
+}
+
+func (s *spillFile) ReadAt(buf []byte, offset int64) (int, error) {
+	if offset >= s.size {
+		return 0, io.EOF
+	}
+	if offset+int64(len(buf)) > s.size {
+		n, err := s.File.ReadAt(buf[:s.size-offset], offset)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return s.File.ReadAt(buf, offset)
+}
+
+func (s *spillFile) WriteAt(p []byte, offset int64) (int, error) {
+	n, err := s.File.WriteAt(p, offset)
+	if end := offset + int64(n); end > s.size {
+		s.size = end
+	}
+	return n, err
+}
+
+func (s *spillFile) Truncate(size int64) error {
+	if err := s.File.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	return nil
+}
+
+func (s *spillFile) remove() error {
+	s.File.Close()
+	return os.Remove(s.File.Name())
+}
+
+// spillDue determines if contents holding resident bytes in memory, after growing
+// by growth, should move to disk
+func (v *volume) spillDue(resident, growth int64) bool {
+	v.Lock()
+	defer v.Unlock()
+	o := v.spillOpts
+	if o.Threshold > 0 && resident > o.Threshold {
+		return true
+	}
+	return o.MemoryLimit > 0 && growth > 0 && v.used.Bytes+growth > o.MemoryLimit
+}
+
+// newSpillFile creates an empty temporary file for spilled contents
+func (v *volume) newSpillFile() (*spillFile, error) {
+	v.Lock()
+	dir := v.spillOpts.Dir
+	v.Unlock()
+
+	fp, err := os.CreateTemp(dir, "memphis-")
+	if err != nil {
+		return nil, err
+	}
+	s := &spillFile{File: fp}
+	v.Lock()
+	v.spilled[s] = struct{}{}
+	v.Unlock()
+	return s, nil
+}
+
+// discard removes a spill file that is no longer referenced
+func (v *volume) discard(s *spillFile) {
+	if v != nil {
+		v.Lock()
+		delete(v.spilled, s)
+		v.Unlock()
+	}
+	s.remove()
+}
+
+// shouldSpill determines if contents growing to size should move to disk
+func (m *memoryContents) shouldSpill(size int64) bool {
+	if m.vol == nil {
+		return false
+	}
+	return m.vol.spillDue(size, size-int64(len(m.bytes)))
+}
+
+// copyFrom streams contents into the file a chunk at a time
+func (s *spillFile) copyFrom(fc FileContent) error {
+	buf := make([]byte, copyBuffer)
+	for off, size := int64(0), fc.Size(); off < size; {
+		n, err := fc.ReadAt(buf, off)
+		if n > 0 {
+			if _, werr := s.WriteAt(buf[:n], off); werr != nil {
+				return werr
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillOut moves contents to a temporary file. If the file cannot be
+// created the contents are left in memory and the error is returned.
+func (m *memoryContents) spillOut() error {
+	s, err := m.vol.newSpillFile()
+	if err != nil {
+		return err
+	}
+	if _, err := s.WriteAt(m.bytes, 0); err != nil {
+		m.vol.discard(s)
+		return err
+	}
+	m.spill = s
+
+	m.account(-int64(len(m.bytes)))
+	m.bytes = nil
+	return nil
+}
+
+// discardContents frees any temporary file held by file contents that are no longer referenced
+func discardContents(fc FileContent) {
+	switch c := fc.(type) {
+	case *memoryContents:
+		if c.spill != nil {
+			c.vol.discard(c.spill)
+		}
+	case *overlayContents:
+		if base, ok := c.base.(*osFileContent); ok && base.vol != nil {
+			base.unpin()
+		}
+		if c.spill != nil {
+			c.owner.vol.discard(c.spill)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package memphis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSpill(t *testing.T) {
+	dir := t.TempDir()
+	root := New()
+	root.SetSpill(SpillOptions{Dir: dir, Threshold: 4})
+	mustWrite(t, root, "small", "123")
+	f := mustWrite(t, root, "large", "123456789")
+
+	if m, ok := f.contents.(*memoryContents); !ok || m.spill == nil {
+		t.Fatalf("contents above the threshold were not spilled: %T", f.contents)
+	}
+	if got := string(f.Bytes()); got != "123456789" {
+		t.Errorf("spilled contents = %q", got)
+	}
+	if got := root.Statfs().Used.Bytes; got != 3 {
+		t.Errorf("%d bytes resident, want only the small file's 3", got)
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 1 {
+		t.Errorf("%d spill files, want 1", len(names))
+	}
+	if err := root.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := os.ReadDir(dir); len(names) != 0 {
+		t.Errorf("Close left %d spill files behind", len(names))
+	}
+}
+
+func TestSpillFailure(t *testing.T) {
+	root := New()
+	root.SetSpill(SpillOptions{Dir: filepath.Join(t.TempDir(), "missing"), Threshold: 4})
+	f, err := root.Create("large", 0, 0, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.replace(strings.NewReader("123456789")); !os.IsNotExist(err) {
+		t.Errorf("write spilling to a missing directory = %v, want ErrNotExist", err)
+	}
+	if m, ok := f.contents.(*memoryContents); ok && m.spill != nil {
+		t.Error("contents were spilled despite the failure")
+	}
+}
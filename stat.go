@@ -0,0 +1,92 @@
+package memphis
+
+import (
+	"encoding/binary"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Stat holds the full metadata of a file or directory
+type Stat struct {
+	Dev    uint64 // Dev identifies the tree the file or directory belongs to
+	Ino    uint64 // Ino identifies the file or directory within its tree
+	Nlink  uint64
+	Mode   os.FileMode
+	Uid    uint32
+	Gid    uint32
+	Rdev   uint64 // Rdev is the device number of a device file, in the Linux encoding
+	Size   int64
+	Blocks int64     // Blocks counts 512-byte blocks
+	Atime  time.Time // Atime is when the contents were last read
+	Mtime  time.Time // Mtime is when the contents were last modified
+	Ctime  time.Time // Ctime is when the contents or metadata were last changed
+	Btime  time.Time // Btime is when the file or directory was created
+}
+
+// lastDevice is the device ID most recently given to a tree
+var lastDevice atomic.Uint64
+
+// allocIno assigns the next inode number of the volume
+func (v *volume) allocIno() uint64 {
+	if v == nil {
+		return 0
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.lastIno++
+	return v.lastIno
+}
+
+func (n *inode) stat(vol *volume, size int64) *Stat {
+	s := &Stat{
+		Ino:    n.ino,
+		Nlink:  1,
+		Mode:   n.mode,
+		Uid:    n.uid,
+		Gid:    n.gid,
+		Size:   size,
+		Blocks: (size + 511) / 512,
+		Atime:  n.accessTime,
+		Mtime:  n.modTime,
+		Ctime:  n.changeTime,
+		Btime:  n.createTime,
+	}
+	if vol != nil {
+		s.Dev = vol.dev
+	}
+	return s
+}
+
+// Stat returns the full metadata of the file
+func (f *File) Stat() *Stat {
+	s := f.stat(f.vol, f.Size())
+	if f.mode&(os.ModeDevice|os.ModeCharDevice) != 0 {
+		s.Rdev = mkdev(f.deviceNumbers())
+	}
+	return s
+}
+
+// Stat returns the full metadata of the directory
+func (t *Tree) Stat() *Stat {
+	t.ready.Do(t.deferred)
+	s := t.stat(t.vol, 0)
+	s.Mode |= os.ModeDir
+	s.Nlink = uint64(2 + len(t.directories))
+	return s
+}
+
+// deviceNumbers reads the major and minor numbers held by a device file
+func (f *File) deviceNumbers() (int64, int64) {
+	b := f.Bytes()
+	if len(b) < 16 {
+		return 0, 0
+	}
+	return int64(binary.LittleEndian.Uint64(b[0:8])), int64(binary.LittleEndian.Uint64(b[8:16]))
+}
+
+// mkdev combines major and minor numbers as the Linux makedev
+func mkdev(major, minor int64) uint64 {
+	maj, min := uint64(major), uint64(minor)
+	return (maj&0xfffff000)<<32 | (maj&0xfff)<<8 | (min&0xffffff00)<<12 | min&0xff
+}
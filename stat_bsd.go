@@ -8,12 +8,17 @@ import (
 	"time"
 )
 
+// errNoAttr is the errno reported for a missing extended attribute
+var errNoAttr = syscall.ENOATTR
+
 func osStat(d *Tree, stat any) {
 	unixStat := stat.(*syscall.Stat_t)
 	d.uid = unixStat.Uid
 	d.gid = unixStat.Gid
 	ts := unixStat.Ctimespec
 	d.createTime = time.Unix(int64(ts.Sec), int64(ts.Nsec))
+	d.changeTime = d.createTime
+	d.accessTime = time.Unix(int64(unixStat.Atimespec.Sec), int64(unixStat.Atimespec.Nsec))
 }
 
 func osStatFile(f *File, stat any) {
@@ -22,4 +27,16 @@ func osStatFile(f *File, stat any) {
 	f.gid = unixStat.Gid
 	ts := unixStat.Ctimespec
 	f.createTime = time.Unix(int64(ts.Sec), int64(ts.Nsec))
+	f.changeTime = f.createTime
+	f.accessTime = time.Unix(int64(unixStat.Atimespec.Sec), int64(unixStat.Atimespec.Nsec))
+}
+
+func osXattrs(path string) xattrSet {
+	// todo: extended attributes
+	return nil
+}
+
+// sys presents metadata as a *Stat
+func sys(s *Stat) interface{} {
+	return s
 }
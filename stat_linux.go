@@ -4,16 +4,23 @@
 package memphis
 
 import (
+	"os"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// errNoAttr is the errno reported for a missing extended attribute
+var errNoAttr = syscall.ENODATA
+
 func osStat(d *Tree, stat any) {
 	unixStat := stat.(*syscall.Stat_t)
 	d.uid = unixStat.Uid
 	d.gid = unixStat.Gid
 	ts := unixStat.Ctim
 	d.createTime = time.Unix(int64(ts.Sec), int64(ts.Nsec))
+	d.changeTime = d.createTime
+	d.accessTime = time.Unix(int64(unixStat.Atim.Sec), int64(unixStat.Atim.Nsec))
 }
 
 func osStatFile(f *File, stat any) {
@@ -22,4 +29,88 @@ func osStatFile(f *File, stat any) {
 	f.gid = unixStat.Gid
 	ts := unixStat.Ctim
 	f.createTime = time.Unix(int64(ts.Sec), int64(ts.Nsec))
+	f.changeTime = f.createTime
+	f.accessTime = time.Unix(int64(unixStat.Atim.Sec), int64(unixStat.Atim.Nsec))
+}
+
+func osXattrs(path string) xattrSet {
+	sz, err := syscall.Listxattr(path, nil)
+	if err != nil || sz <= 0 {
+		return nil
+	}
+	buf := make([]byte, sz)
+	sz, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil
+	}
+	x := make(xattrSet)
+	for _, name := range strings.Split(string(buf[:sz]), "\x00") {
+		if name == "" {
+			continue
+		}
+		vsz, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		val := make([]byte, vsz)
+		if vsz, err = syscall.Getxattr(path, name, val); err != nil {
+			continue
+		}
+		x[name] = val[:vsz]
+	}
+	return x
+}
+
+// sys presents metadata as a *syscall.Stat_t, whose field types vary by architecture
+func sys(s *Stat) interface{} {
+	st := &syscall.Stat_t{}
+	setInt(&st.Dev, s.Dev)
+	setInt(&st.Ino, s.Ino)
+	setInt(&st.Nlink, s.Nlink)
+	setInt(&st.Mode, uint64(unixMode(s.Mode)))
+	setInt(&st.Uid, uint64(s.Uid))
+	setInt(&st.Gid, uint64(s.Gid))
+	setInt(&st.Rdev, s.Rdev)
+	setInt(&st.Size, uint64(s.Size))
+	setInt(&st.Blksize, 4096)
+	setInt(&st.Blocks, uint64(s.Blocks))
+	st.Atim = syscall.NsecToTimespec(s.Atime.UnixNano())
+	st.Mtim = syscall.NsecToTimespec(s.Mtime.UnixNano())
+	st.Ctim = syscall.NsecToTimespec(s.Ctime.UnixNano())
+	return st
+}
+
+func setInt[T ~int32 | ~int64 | ~uint32 | ~uint64](field *T, v uint64) {
+	*field = T(v)
+}
+
+// unixMode converts a mode to the st_mode bits of Linux
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m&os.ModeDir != 0:
+		mode |= syscall.S_IFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	case m&os.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case m&os.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	case m&os.ModeCharDevice != 0:
+		mode |= syscall.S_IFCHR
+	case m&os.ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	if m&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	return mode
 }
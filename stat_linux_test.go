@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package memphis
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestStatSys(t *testing.T) {
+	root := New()
+	f := mustWrite(t, root, "f", "data")
+	info, err := root.AsBillyFS(0, 0).Stat("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Fatalf("Sys() = %T, want *syscall.Stat_t", info.Sys())
+	}
+	s := f.Stat()
+	if uint64(st.Ino) != s.Ino || uint64(st.Dev) != s.Dev || st.Size != 4 {
+		t.Errorf("Sys() = %+v, want ino %d on device %d", st, s.Ino, s.Dev)
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFREG || st.Mode&0777 != 0644 {
+		t.Errorf("Sys() mode = %o", st.Mode)
+	}
+}
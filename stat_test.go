@@ -0,0 +1,53 @@
+package memphis
+
+import (
+	"os"
+	"testing"
+
+	"github.com/polydawn/rio/fs"
+)
+
+func TestStatIdentity(t *testing.T) {
+	root := New()
+	a := mustWrite(t, root, "a", "data")
+	b := mustWrite(t, root, "b", "data")
+	if a.Stat().Ino == b.Stat().Ino {
+		t.Error("two files share an inode number")
+	}
+	if a.Stat().Dev != root.Stat().Dev || New().Stat().Dev == root.Stat().Dev {
+		t.Error("device IDs must be shared within a tree and differ between trees")
+	}
+
+	ino := a.Stat().Ino
+	if err := root.Rename("a", root, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := root.entry("c").file.Stat().Ino; got != ino {
+		t.Errorf("rename changed the inode number from %d to %d", ino, got)
+	}
+	// numbers of removed entries are not reused
+	if err := root.AsBillyFS(0, 0).Remove("c"); err != nil {
+		t.Fatal(err)
+	}
+	if d := mustWrite(t, root, "d", "data"); d.Stat().Ino == ino {
+		t.Error("a removed file's inode number was reused")
+	}
+}
+
+func TestStatDevice(t *testing.T) {
+	root := New()
+	p := root.AsPlacer(0, 0)
+	if err := p.MkdevChar(fs.MustRelPath("null"), 1, 3, 0666); err != nil {
+		t.Fatal(err)
+	}
+	s := root.entry("null").file.Stat()
+	if s.Rdev != 0x103 || s.Mode&os.ModeCharDevice == 0 {
+		t.Errorf("device stat = rdev %#x, mode %v", s.Rdev, s.Mode)
+	}
+	if s := mustWrite(t, root, "f", "data").Stat(); s.Rdev != 0 || s.Blocks != 1 || s.Nlink != 1 {
+		t.Errorf("regular file stat = %+v", s)
+	}
+	if _, err := root.AsBillyFS(0, 0).Stat("missing"); !os.IsNotExist(err) {
+		t.Errorf("Stat of a missing file = %v", err)
+	}
+}
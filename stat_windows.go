@@ -8,14 +8,29 @@ import (
 	"time"
 )
 
+// errNoAttr is the errno reported for a missing extended attribute
+var errNoAttr = syscall.ENODATA
+
 func osStat(d *Tree, stat any) {
 	winStat := stat.(*syscall.Win32FileAttributeData)
 	// todo: uid/gid
 	d.createTime = time.Unix(0, winStat.CreationTime.Nanoseconds())
+	d.accessTime = time.Unix(0, winStat.LastAccessTime.Nanoseconds())
 }
 
 func osStatFile(f *File, stat any) {
 	winStat := stat.(*syscall.Win32FileAttributeData)
 	// todo: uid/gid
 	f.createTime = time.Unix(0, winStat.CreationTime.Nanoseconds())
+	f.accessTime = time.Unix(0, winStat.LastAccessTime.Nanoseconds())
+}
+
+func osXattrs(path string) xattrSet {
+	// todo: extended attributes
+	return nil
+}
+
+// sys presents metadata as a *Stat
+func sys(s *Stat) interface{} {
+	return s
 }
@@ -0,0 +1,71 @@
+package memphis
+
+import (
+	"time"
+)
+
+// AtimePolicy selects when reads update access times, following the Linux mount options
+type AtimePolicy int
+
+const (
+	// AtimeRelative updates the access time when it is older than the modification
+	// or change time, or more than a day old, as relatime.
+	AtimeRelative AtimePolicy = iota
+	// AtimeStrict updates the access time on every read, as strictatime.
+	AtimeStrict
+	// AtimeNone never updates access times, as noatime.
+	AtimeNone
+)
+
+// relatimeInterval is how stale an access time may become under AtimeRelative
+const relatimeInterval = 24 * time.Hour
+
+// SetAtimePolicy sets when reads in the tree this directory belongs to update access times.
+func (t *Tree) SetAtimePolicy(p AtimePolicy) {
+	t.vol.Lock()
+	defer t.vol.Unlock()
+	t.vol.atime = p
+}
+
+func (v *volume) atimePolicy() AtimePolicy {
+	if v == nil {
+		return AtimeRelative
+	}
+	v.Lock()
+	defer v.Unlock()
+	return v.atime
+}
+
+// updateTimes records a change to the inode. Writes update the modification time,
+// and every change updates the change time.
+func (n *inode) updateTimes(op Op, now time.Time) {
+	if op&OpWrite != 0 {
+		n.modTime = now
+	}
+	n.changeTime = now
+}
+
+// entriesChanged records that entries were added to or removed from the directory
+func (t *Tree) entriesChanged() {
+	t.updateTimes(OpWrite, t.vol.now())
+}
+
+// accessed records a read of the inode, as allowed by the policy
+func (n *inode) accessed(p AtimePolicy, now time.Time) {
+	switch p {
+	case AtimeNone:
+		return
+	case AtimeRelative:
+		if n.accessTime.After(n.modTime) && n.accessTime.After(n.changeTime) &&
+			now.Sub(n.accessTime) < relatimeInterval {
+			return
+		}
+	}
+	n.accessTime = now
+}
+
+// setTimes explicitly sets the access and modification times, as utimes(2)
+func (n *inode) setTimes(atime, mtime time.Time) {
+	n.accessTime = atime
+	n.modTime = mtime
+}
@@ -0,0 +1,105 @@
+package memphis
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTimes(t *testing.T) {
+	root := New()
+	root.SetClock(StepClock(testEpoch, time.Second))
+	f := mustWrite(t, root, "f", "data")
+	born := f.createTime
+	if f.modTime.Before(born) || f.changeTime.Before(born) {
+		t.Errorf("times precede the birth time %v", born)
+	}
+
+	b := root.AsBillyFS(0, 0)
+	mod := f.modTime
+	if err := b.Chmod("f", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !f.modTime.Equal(mod) || !f.changeTime.After(mod) {
+		t.Error("chmod must update only the change time")
+	}
+	if err := b.Chtimes("f", testEpoch, testEpoch); err != nil {
+		t.Fatal(err)
+	}
+	if !f.modTime.Equal(testEpoch) || !f.accessTime.Equal(testEpoch) || !f.createTime.Equal(born) {
+		t.Errorf("Chtimes set mtime %v, atime %v and birth %v", f.modTime, f.accessTime, f.createTime)
+	}
+	if _, ok := b.Chtimes("missing", testEpoch, testEpoch).(*os.PathError); !ok {
+		t.Error("Chtimes of a missing file did not fail with a path error")
+	}
+}
+
+func TestAtimePolicy(t *testing.T) {
+	read := func(root *Tree) {
+		t.Helper()
+		f, err := root.AsBillyFS(0, 0).Open("f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(f)
+		f.Close()
+	}
+	for _, c := range []struct {
+		policy  AtimePolicy
+		updates []bool // updates is whether each of two reads updates the access time
+	}{
+		{AtimeStrict, []bool{true, true}},
+		{AtimeRelative, []bool{true, false}},
+		{AtimeNone, []bool{false, false}},
+	} {
+		root := New()
+		root.SetClock(StepClock(testEpoch, time.Second))
+		root.SetAtimePolicy(c.policy)
+		f := mustWrite(t, root, "f", "data")
+		for i, want := range c.updates {
+			before := f.accessTime
+			read(root)
+			if got := !f.accessTime.Equal(before); got != want {
+				t.Errorf("policy %d, read %d: access time updated = %v, want %v", c.policy, i, got, want)
+			}
+		}
+	}
+}
+
+func TestDirTimes(t *testing.T) {
+	root := New()
+	root.SetClock(StepClock(testEpoch, time.Second))
+	d, err := root.CreateDir("d", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := root.AsBillyFS(0, 0)
+	for _, change := range []struct {
+		name string
+		op   func() error
+	}{
+		{"create", func() error { _, err := d.Create("f", 0, 0, 0644); return err }},
+		{"rename", func() error { return b.Rename("d/f", "d/g") }},
+		{"remove", func() error { return b.Remove("d/g") }},
+	} {
+		mod, changed := d.modTime, d.changeTime
+		if err := change.op(); err != nil {
+			t.Fatal(err)
+		}
+		if !d.modTime.After(mod) || !d.changeTime.After(changed) {
+			t.Errorf("%s did not update the directory's times", change.name)
+		}
+	}
+	// a failed change leaves the directory as it was
+	mod := d.modTime
+	if err := b.Remove("d/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Remove of a missing entry = %v", err)
+	}
+	if !d.modTime.Equal(mod) {
+		t.Error("a failed remove updated the directory's modification time")
+	}
+}
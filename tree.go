@@ -9,138 +9,100 @@ import (
 
 // Tree represents a directory
 type Tree struct {
-	ready       sync.Once
-	deferred    func()
-	uid         uint32
-	gid         uint32
-	mode        os.FileMode
+	ready    sync.Once
+	deferred func()
+	osPath   string
+	vol      *volume
+	parent   *Tree
+	name     string
+	inode
+	defaultACL  ACL
 	directories map[string]*Tree
 	files       map[string]*File
-	createTime  time.Time
-	modTime     time.Time
+	index       []string // index holds the names of the entries, sorted
+	hashes      hashMemo
 }
 
-func newTree(euid, egid uint32, perm os.FileMode) *Tree {
+func newTree(vol *volume, euid, egid uint32, perm os.FileMode) *Tree {
 	return &Tree{
 		deferred:    noOp,
-		uid:         euid,
-		gid:         egid,
-		mode:        perm,
+		vol:         vol,
+		inode:       vol.newInode(euid, egid, perm),
 		directories: make(map[string]*Tree),
 		files:       make(map[string]*File),
-		createTime:  time.Now(),
-		modTime:     time.Now(),
 	}
 }
 
 // Create makes a new file in the directory
-func (t *Tree) Create(name string, euid, egid uint32, perm os.FileMode) *File {
+func (t *Tree) Create(name string, euid, egid uint32, perm os.FileMode) (*File, error) {
 	t.ready.Do(t.deferred)
-	t.files[name] = &File{
-		name:       name,
-		mode:       perm,
-		uid:        euid,
-		gid:        egid,
-		createTime: time.Now(),
-		modTime:    time.Now(),
-		contents:   NewEmptyFileContents(),
+	if err := t.checkEntries(name); err != nil {
+		return nil, err
 	}
-	return t.files[name]
+	if err := t.vol.charge(euid, 0, 1); err != nil {
+		return nil, err
+	}
+	f := &File{
+		name:   name,
+		vol:    t.vol,
+		parent: t,
+		inode:  t.vol.newInode(euid, egid, perm),
+	}
+	f.inheritACL(t.defaultACL)
+	f.contents = f.emptyContents()
+	if old, ok := t.files[name]; ok {
+		old.release()
+	}
+	t.files[name] = f
+	t.indexAdd(name)
+	t.entriesChanged()
+	t.notify(OpCreate, name)
+	return f, nil
 }
 
 func noOp() {}
 
 // CreateDir makes a new directory in the directory
-func (t *Tree) CreateDir(name string, euid, egid uint32, perm os.FileMode) *Tree {
+func (t *Tree) CreateDir(name string, euid, egid uint32, perm os.FileMode) (*Tree, error) {
 	t.ready.Do(t.deferred)
-	t.directories[name] = newTree(euid, egid, perm)
-	return t.directories[name]
+	if err := t.checkEntries(name); err != nil {
+		return nil, err
+	}
+	if err := t.vol.charge(euid, 0, 1); err != nil {
+		return nil, err
+	}
+	if old, ok := t.directories[name]; ok {
+		old.release()
+	}
+	d := newTree(t.vol, euid, egid, perm)
+	d.parent = t
+	d.name = name
+	d.inheritACL(t.defaultACL)
+	d.defaultACL = t.defaultACL.copy()
+	t.directories[name] = d
+	t.indexAdd(name)
+	t.entriesChanged()
+	t.notify(OpCreate, name)
+	return d, nil
 }
 
-// WalkDir descends to a given sub directory
+// WalkDir descends to a given sub directory. The directory is treated as the root
+// for absolute symlinks and '..'.
 func (t *Tree) WalkDir(p []string) *Tree {
-	t.ready.Do(t.deferred)
-
-	node := t
-	path := []string{}
-
-	remaining := p
-	for len(remaining) > 0 {
-		part := remaining[0]
-		remaining = remaining[1:]
-		if part == "." || part == "" {
-			continue
-		}
-		if part == ".." {
-			if len(path) > 0 {
-				path = path[:len(path)-1]
-				// TODO: circular symlinks will infiniloop
-				node = t.WalkDir(path)
-				continue
-			} else {
-				return nil //directory traversal
-			}
-		}
-		n, ok := node.directories[part]
-		if ok {
-			node = n
-			n.ready.Do(n.deferred)
-			path = append(path, part)
-			continue
-		}
-		f, ok := node.files[part]
-		if ok && f.Mode()&os.ModeSymlink != 0 {
-			target := strings.Split(string(f.Bytes()), Separator)
-			if target[0] == "" {
-				target = target[1:]
-				path = []string{}
-				node = t
-			}
-			remaining = append(target, remaining...)
-			continue
-		}
-
+	r, err := t.lookup(t, strings.Join(p, Separator), 0)
+	if err != nil {
 		return nil
 	}
-	return node
+	return r.dir
 }
 
 // Get attempts to get a file at a given path.
 func (t *Tree) Get(p []string, followSymlinks bool) (*File, *Tree, error) {
-	t.ready.Do(t.deferred)
-	if len(p) == 0 {
-		return nil, nil, os.ErrNotExist
-	}
-	fname := p[len(p)-1]
-	base := t
-	if len(p) > 1 {
-		base = t.WalkDir(p[:len(p)-1])
-	}
-	if base == nil {
-		return nil, nil, os.ErrNotExist
-	}
-
-	if d, ok := base.directories[fname]; ok {
-		d.ready.Do(d.deferred)
-		return nil, d, nil
-	}
-
-	f, ok := base.files[fname]
-	if !ok {
-		return nil, nil, os.ErrNotExist
-	}
-	// Check permissions
-	// TODO
-
-	// Resolve symlinks
-	if followSymlinks && ((f.Mode() & os.ModeSymlink) != 0) {
-		target := strings.Split(string(f.Bytes()), Separator)
-		if target[0] == "" {
-			return t.Get(target[1:], true)
-		}
-		return t.Get(append(p[0:len(p)-1], target...), true)
+	flags := ResolveInRoot
+	if !followSymlinks {
+		flags |= ResolveNoFollow
 	}
-	return f, nil, nil
+	return t.Resolve(strings.Join(p, Separator), flags)
 }
 
 // DirMeta is a struct of metadata about a directory
@@ -174,7 +136,8 @@ func (d *DirMeta) IsDir() bool {
 	return true
 }
 
-// Sys provides os.FileInfo trapdoor down to undefined behavior
+// Sys returns the full metadata of the directory. It is a *syscall.Stat_t on Linux,
+// and a *Stat elsewhere.
 func (d *DirMeta) Sys() interface{} {
-	return nil
+	return sys(d.Tree.Stat())
 }
@@ -0,0 +1,45 @@
+package memphis
+
+import (
+	"sync"
+)
+
+// volume holds state shared by every directory of a single memphis tree
+type volume struct {
+	sync.Mutex
+	limits Limits
+	used   Usage
+	users  map[uint32]*Usage
+
+	spillOpts SpillOptions
+	spilled   map[*spillFile]struct{}
+
+	fds    *fdCache
+	policy Consistency
+
+	watchLock sync.Mutex
+	watchers  map[*Watcher]struct{}
+
+	locks  *lockManager
+	groups GroupInheritance
+	atime  AtimePolicy
+	clock  Clock
+
+	dev     uint64 // dev is the device ID of the tree
+	lastIno uint64
+
+	hashLock sync.Mutex // hashLock guards memoized digests
+	hashGen  uint64     // hashGen counts invalidations, so digests computed across one are not memoized
+}
+
+func newVolume() *volume {
+	return &volume{
+		users:    make(map[uint32]*Usage),
+		spilled:  make(map[*spillFile]struct{}),
+		fds:      newFDCache(defaultDescriptorCacheSize),
+		watchers: make(map[*Watcher]struct{}),
+		locks:    newLockManager(),
+		clock:    RealClock(),
+		dev:      lastDevice.Add(1),
+	}
+}
@@ -0,0 +1,237 @@
+package memphis
+
+import (
+	iofs "io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WalkFunc is called for each entry visited by Walk, with its path relative to the
+// starting directory. Returning fs.SkipDir from a directory skips its contents, and
+// from a file skips the rest of its directory. fs.SkipAll stops the walk.
+type WalkFunc func(p string, info os.FileInfo) error
+
+// Walk visits the directory and everything beneath it in name order, starting with
+// the directory itself as ".". Symlinks are not followed. Directories imported from disk
+// are only read when they are visited, so skipped subtrees are left alone.
+func (t *Tree) Walk(fn WalkFunc) error {
+	err := t.walk(".", ".", fn)
+	if err == iofs.SkipDir || err == iofs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (t *Tree) walk(p, name string, fn WalkFunc) error {
+	if err := fn(p, &DirMeta{name, t}); err != nil {
+		if err == iofs.SkipDir {
+			return nil
+		}
+		return err
+	}
+	// the listing is only read now fn has chosen to descend
+	for _, n := range t.Names() {
+		cp := path.Join(p, n)
+		if d, ok := t.directories[n]; ok {
+			if err := d.walk(cp, n, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(cp, t.files[n]); err != nil {
+			if err == iofs.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Glob finds the paths relative to the directory matching pattern, in sorted order.
+// Components match as path.Match, and a "**" component matches any number of
+// directories, including none. A final "**" matches the files in those directories
+// too, so "src/**" finds everything beneath src. Only directories a pattern can
+// match into are read.
+func (t *Tree) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	parts, _ := splitPath(pattern)
+	found := map[string]struct{}{}
+	if err := t.glob("", parts, found); err != nil {
+		return nil, err
+	}
+	matches := make([]string, 0, len(found))
+	for m := range found {
+		matches = append(matches, m)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (t *Tree) glob(prefix string, parts []string, found map[string]struct{}) error {
+	if len(parts) == 0 {
+		if prefix != "" {
+			found[prefix] = struct{}{}
+		}
+		return nil
+	}
+	t.ready.Do(t.deferred)
+	part, rest := parts[0], parts[1:]
+
+	if part == "**" {
+		if err := t.glob(prefix, rest, found); err != nil {
+			return err
+		}
+		for _, n := range t.Names() {
+			if d, ok := t.directories[n]; ok {
+				if err := d.glob(path.Join(prefix, n), parts, found); err != nil {
+					return err
+				}
+			} else if len(rest) == 0 {
+				found[path.Join(prefix, n)] = struct{}{}
+			}
+		}
+		return nil
+	}
+
+	names := []string{part}
+	if strings.ContainsAny(part, `*?[\`) {
+		names = t.Names()
+	}
+	for _, n := range names {
+		if ok, err := path.Match(part, n); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		if d, ok := t.directories[n]; ok {
+			if err := d.glob(path.Join(prefix, n), rest, found); err != nil {
+				return err
+			}
+		} else if _, ok := t.files[n]; ok && len(rest) == 0 {
+			found[path.Join(prefix, n)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Query selects entries for Find. Unset fields match everything.
+type Query struct {
+	Name           *regexp.Regexp // Name matches against the final component of the path
+	Types          []os.FileMode  // Types lists the acceptable mode types, as FileMode.Type, with 0 for regular files
+	MinSize        int64
+	MaxSize        int64 // MaxSize is ignored when 0
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Uid            *uint32
+	Gid            *uint32
+	PermAll        os.FileMode // PermAll requires all of these permission bits, as find -perm -mode
+	PermAny        os.FileMode // PermAny requires any of these permission bits, as find -perm /mode
+	MaxDepth       int         // MaxDepth limits how far below the directory to search, when above 0
+	Parallel       int         // Parallel sets how many subtrees may be searched at once, when above 1
+}
+
+func (q *Query) matches(p string, n *inode, mode os.FileMode, size int64) bool {
+	if q.Name != nil && !q.Name.MatchString(path.Base(p)) {
+		return false
+	}
+	if len(q.Types) > 0 {
+		ok := false
+		for _, typ := range q.Types {
+			ok = ok || typ.Type() == mode.Type()
+		}
+		if !ok {
+			return false
+		}
+	}
+	if size < q.MinSize || (q.MaxSize != 0 && size > q.MaxSize) {
+		return false
+	}
+	if !q.ModifiedAfter.IsZero() && !n.modTime.After(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !n.modTime.Before(q.ModifiedBefore) {
+		return false
+	}
+	if (q.Uid != nil && n.uid != *q.Uid) || (q.Gid != nil && n.gid != *q.Gid) {
+		return false
+	}
+	if mode&q.PermAll != q.PermAll {
+		return false
+	}
+	return q.PermAny == 0 || mode&q.PermAny != 0
+}
+
+// finder collects the results of a Find
+type finder struct {
+	q     *Query
+	mu    sync.Mutex
+	found []string
+	slots chan struct{} // slots bounds how many extra subtrees are searched at once
+	wg    sync.WaitGroup
+}
+
+// Find searches the directory and everything beneath it for entries matching the query,
+// returning their paths relative to the directory in sorted order. Symlinks are not followed.
+// Directories imported from disk are only read when they are searched, so are left
+// alone beyond MaxDepth. Parallel searches must not race with changes to the tree.
+func (t *Tree) Find(q Query) []string {
+	f := &finder{q: &q}
+	if q.Parallel > 1 {
+		f.slots = make(chan struct{}, q.Parallel-1)
+	}
+	t.ready.Do(t.deferred)
+	if f.q.matches(".", &t.inode, t.mode|os.ModeDir, 0) {
+		f.add(".")
+	}
+	f.search(t, "", 1)
+	f.wg.Wait()
+	sort.Strings(f.found)
+	return f.found
+}
+
+func (f *finder) add(p string) {
+	f.mu.Lock()
+	f.found = append(f.found, p)
+	f.mu.Unlock()
+}
+
+func (f *finder) search(t *Tree, prefix string, depth int) {
+	if f.q.MaxDepth > 0 && depth > f.q.MaxDepth {
+		return
+	}
+	for _, n := range t.Names() {
+		p := path.Join(prefix, n)
+		if file, ok := t.files[n]; ok {
+			if f.q.matches(p, &file.inode, file.mode, file.Size()) {
+				f.add(p)
+			}
+			continue
+		}
+		d := t.directories[n]
+		if f.q.matches(p, &d.inode, d.mode|os.ModeDir, 0) {
+			f.add(p)
+		}
+		if f.q.MaxDepth > 0 && depth >= f.q.MaxDepth {
+			// its listing is left unread, as nothing in it is searched
+			continue
+		}
+		select {
+		case f.slots <- struct{}{}:
+			f.wg.Add(1)
+			go func() {
+				defer func() { <-f.slots; f.wg.Done() }()
+				f.search(d, p, depth+1)
+			}()
+		default:
+			f.search(d, p, depth+1)
+		}
+	}
+}
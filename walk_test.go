@@ -0,0 +1,108 @@
+package memphis
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// globTree lays out src/a.go, src/sub/b.go, src/sub/c.txt and doc/foo
+func globTree(t *testing.T) *Tree {
+	root := New()
+	src, _ := root.CreateDir("src", 0, 0, 0755)
+	sub, _ := src.CreateDir("sub", 0, 0, 0755)
+	doc, _ := root.CreateDir("doc", 0, 0, 0755)
+	mustWrite(t, src, "a.go", "")
+	mustWrite(t, sub, "b.go", "")
+	mustWrite(t, sub, "c.txt", "")
+	mustWrite(t, doc, "foo", "")
+	return root
+}
+
+func TestGlob(t *testing.T) {
+	root := globTree(t)
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"src/*.go", []string{"src/a.go"}},
+		{"*/sub", []string{"src/sub"}},
+		{"**/*.go", []string{"src/a.go", "src/sub/b.go"}},
+		{"src/**", []string{"src", "src/a.go", "src/sub", "src/sub/b.go", "src/sub/c.txt"}},
+		{"**/foo", []string{"doc/foo"}},
+		{"missing/*", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := root.Glob(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Glob(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+	if _, err := root.Glob("[x"); err == nil {
+		t.Error("Glob of a malformed pattern succeeded")
+	}
+}
+
+func TestGlobFromOS(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(dir, "foo"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "a", "b", "foo"), nil, 0644)
+
+	got, err := FromOS(dir).Glob("**/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/b/foo", "foo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Glob(**/foo) = %v, want %v", got, want)
+	}
+}
+
+func TestWalkSkipDir(t *testing.T) {
+	root := globTree(t)
+	sub := root.directories["src"].directories["sub"]
+	forced := false
+	sub.ready = sync.Once{}
+	sub.deferred = func() { forced = true }
+
+	visited := []string{}
+	err := root.Walk(func(p string, info os.FileInfo) error {
+		visited = append(visited, p)
+		if p == "src/sub" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "doc", "doc/foo", "src", "src/a.go", "src/sub"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk visited %v, want %v", visited, want)
+	}
+	if forced {
+		t.Error("Walk read the listing of a skipped directory")
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := globTree(t)
+	got := root.Find(Query{Name: regexp.MustCompile(`\.go$`), Parallel: 4})
+	if want := []string{"src/a.go", "src/sub/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Find(*.go) = %v, want %v", got, want)
+	}
+	got = root.Find(Query{Types: []os.FileMode{os.ModeDir}, MaxDepth: 1})
+	if want := []string{".", "doc", "src"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Find(dirs, depth 1) = %v, want %v", got, want)
+	}
+	if got := root.Find(Query{MinSize: 1}); len(got) != 0 {
+		t.Errorf("Find(size >= 1) = %v, want nothing", got)
+	}
+}
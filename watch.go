@@ -0,0 +1,196 @@
+package memphis
+
+import (
+	"path"
+	"strings"
+)
+
+// Op describes a kind of change to the filesystem, following fsnotify.
+type Op uint32
+
+// Operations reported to watchers
+const (
+	OpCreate Op = 1 << iota
+	OpWrite
+	OpRemove
+	OpRename
+	OpChmod
+)
+
+func (op Op) String() string {
+	names := []string{}
+	for i, n := range []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"} {
+		if op&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change to the filesystem observed by a Watcher
+type Event struct {
+	Name    string // Name is the path of the affected entry
+	OldName string // OldName is the previous path of an entry created by a rename, if it was watched
+	Op      Op
+}
+
+func (e Event) String() string {
+	if e.OldName != "" {
+		return e.Op.String() + " " + e.OldName + " -> " + e.Name
+	}
+	return e.Op.String() + " " + e.Name
+}
+
+// defaultWatchBuffer is the size of a watcher's event channel if none is given
+const defaultWatchBuffer = 64
+
+// Watcher delivers events about changes beneath a directory.
+// If events are not consumed fast enough they are dropped and ErrOverflow is sent on Errors.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	vol       *volume
+	dir       *Tree
+	base      string
+	recursive bool
+}
+
+// Watch subscribes to changes to entries of the directory, and of all of its
+// descendants if recursive is set. Event names are relative to the directory.
+// buffer sets how many events can be queued; 0 uses a default.
+func (t *Tree) Watch(recursive bool, buffer int) *Watcher {
+	return t.watch("", recursive, buffer)
+}
+
+// Watch subscribes to changes beneath a directory in the filesystem. Event names
+// are prefixed with name, as in fsnotify.
+func (b *Billy) Watch(name string, recursive bool, buffer int) (*Watcher, error) {
+	dir, err := b.dir(name)
+	if err != nil {
+		return nil, pathError("watch", name, err)
+	}
+	return dir.watch(name, recursive, buffer), nil
+}
+
+func (t *Tree) watch(base string, recursive bool, buffer int) *Watcher {
+	t.ready.Do(t.deferred)
+	if buffer <= 0 {
+		buffer = defaultWatchBuffer
+	}
+	w := &Watcher{
+		Events:    make(chan Event, buffer),
+		Errors:    make(chan error, 1),
+		vol:       t.vol,
+		dir:       t,
+		base:      base,
+		recursive: recursive,
+	}
+	t.vol.watchLock.Lock()
+	defer t.vol.watchLock.Unlock()
+	t.vol.watchers[w] = struct{}{}
+	return w
+}
+
+// Close stops delivery of events and closes the watcher's channels.
+func (w *Watcher) Close() error {
+	w.vol.watchLock.Lock()
+	defer w.vol.watchLock.Unlock()
+	if _, ok := w.vol.watchers[w]; !ok {
+		return nil
+	}
+	delete(w.vol.watchers, w)
+	close(w.Events)
+	close(w.Errors)
+	return nil
+}
+
+// relative finds the path of an entry in dir relative to the watched directory
+func (w *Watcher) relative(dir *Tree, name string) (string, bool) {
+	if w.dir.parent == dir && w.dir.name == name {
+		return w.name(""), true
+	}
+	parts := []string{name}
+	for cur := dir; cur != nil; cur = cur.parent {
+		if cur == w.dir {
+			if len(parts) > 1 && !w.recursive {
+				return "", false
+			}
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+			return w.name(path.Join(parts...)), true
+		}
+		parts = append(parts, cur.name)
+	}
+	return "", false
+}
+
+func (w *Watcher) name(rel string) string {
+	if p := path.Join(w.base, rel); p != "" {
+		return p
+	}
+	return "."
+}
+
+func (w *Watcher) send(e Event) {
+	select {
+	case w.Events <- e:
+	default:
+		select {
+		case w.Errors <- ErrOverflow:
+		default:
+		}
+	}
+}
+
+// notify reports a change to the entry name in directory t
+func (t *Tree) notify(op Op, name string) {
+	t.notifyRename(op, name, nil, "")
+}
+
+// notifyRename reports a change to an entry in t that was previously oldName in oldDir
+func (t *Tree) notifyRename(op Op, name string, oldDir *Tree, oldName string) {
+	v := t.vol
+	v.watchLock.Lock()
+	defer v.watchLock.Unlock()
+	if len(v.watchers) == 0 {
+		return
+	}
+	for w := range v.watchers {
+		p, ok := w.relative(t, name)
+		if !ok {
+			continue
+		}
+		e := Event{Name: p, Op: op}
+		if oldDir != nil {
+			e.OldName, _ = w.relative(oldDir, oldName)
+		}
+		w.send(e)
+	}
+}
+
+// changed reports a change to the file
+func (f *File) changed(op Op) {
+	f.mu.Lock()
+	f.updateTimes(op, f.vol.now())
+	if op&OpWrite != 0 {
+		f.osLink = nil
+	}
+	f.mu.Unlock()
+	f.invalidateHash(op&OpWrite != 0)
+	if f.parent != nil {
+		f.parent.notify(op, f.name)
+	}
+}
+
+// changed reports a change to the directory itself
+func (t *Tree) changed(op Op) {
+	t.updateTimes(op, t.vol.now())
+	t.invalidateHash()
+	if t.parent != nil {
+		t.parent.notify(op, t.name)
+	} else {
+		t.notify(op, "")
+	}
+}
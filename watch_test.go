@@ -0,0 +1,81 @@
+package memphis
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// events drains the events queued on a watcher
+func events(w *Watcher) []Event {
+	var got []Event
+	for {
+		select {
+		case e, ok := <-w.Events:
+			if !ok {
+				return got
+			}
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	root := New()
+	sub, err := root.CreateDir("sub", 0, 0, 0755|os.ModeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat := root.Watch(false, 0)
+	deep := root.Watch(true, 0)
+	defer flat.Close()
+	defer deep.Close()
+
+	mustWrite(t, root, "a", "data")
+	mustWrite(t, sub, "b", "data")
+	if err := root.Rename("a", sub, "c", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got := events(flat)
+	if len(got) == 0 || got[0] != (Event{Name: "a", Op: OpCreate}) {
+		t.Errorf("first event = %v, want CREATE a", got)
+	}
+	for _, e := range got {
+		if e.Name == "sub/b" || e.Name == "sub/c" {
+			t.Errorf("non-recursive watcher saw %v", e)
+		}
+	}
+	found := false
+	for _, e := range events(deep) {
+		if e == (Event{Name: "sub/c", OldName: "a", Op: OpCreate}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("recursive watcher did not see the rename into sub")
+	}
+}
+
+func TestWatchOverflow(t *testing.T) {
+	root := New()
+	w := root.Watch(false, 1)
+	mustWrite(t, root, "a", "data")
+	mustWrite(t, root, "b", "data")
+	if err := <-w.Errors; !errors.Is(err, ErrOverflow) {
+		t.Errorf("error after the buffer filled = %v, want ErrOverflow", err)
+	}
+	w.Close()
+	if got := events(w); len(got) != 1 {
+		t.Errorf("%d events queued, want the buffer's 1", len(got))
+	}
+	if _, ok := <-w.Events; ok {
+		t.Error("Close left the events channel open")
+	}
+
+	if _, err := root.AsBillyFS(0, 0).Watch("missing", false, 0); !os.IsNotExist(err) {
+		t.Errorf("Watch of a missing directory = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,309 @@
+package memphis
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/polydawn/rio/fs"
+)
+
+// Limits on extended attributes, matching those of Linux
+const (
+	XattrNameMax = 255   // XattrNameMax is the longest allowed attribute name
+	XattrSizeMax = 65536 // XattrSizeMax is the largest allowed attribute value
+	XattrListMax = 65536 // XattrListMax bounds the total size of names and values on a single file
+)
+
+// Flags for Setxattr
+const (
+	XattrCreate  = 1 // XattrCreate fails if the attribute already exists
+	XattrReplace = 2 // XattrReplace fails if the attribute does not exist
+)
+
+// xattrSet holds the extended attributes of a file or directory
+type xattrSet map[string][]byte
+
+// checkXattr validates an attribute name against namespace rules.
+// trusted attributes are only visible to privileged users, and security attributes
+// may only be modified by them.
+func checkXattr(attr string, privileged, write bool) error {
+	if len(attr) > XattrNameMax || attr == "" {
+		return ErrRange
+	}
+	switch {
+	case strings.HasPrefix(attr, "user."):
+		return nil
+	case strings.HasPrefix(attr, "trusted."):
+		if !privileged {
+			return ErrNotPermitted
+		}
+		return nil
+	case strings.HasPrefix(attr, "security."):
+		if write && !privileged {
+			return ErrNotPermitted
+		}
+		return nil
+	}
+	return ErrNotSupported
+}
+
+// userXattrAllowed checks if user attributes may be set on a file of the given mode,
+// which Linux restricts to regular files and directories.
+func userXattrAllowed(attr string, mode os.FileMode) bool {
+	return !strings.HasPrefix(attr, "user.") || mode&(os.ModeType&^os.ModeDir) == 0
+}
+
+func (x xattrSet) size() int {
+	s := 0
+	for n, v := range x {
+		s += len(n) + 1 + len(v)
+	}
+	return s
+}
+
+// xattrNode is a file or directory whose extended attributes are being accessed
+type xattrNode struct {
+	*inode
+	dir     *Tree // dir is set when the node is a directory
+	changed func(Op)
+}
+
+func xattrNodeOf(f *File, d *Tree) xattrNode {
+	if f != nil {
+		return xattrNode{&f.inode, nil, f.changed}
+	}
+	return xattrNode{&d.inode, d, d.changed}
+}
+
+func (n xattrNode) get(attr string, privileged bool) ([]byte, error) {
+	if isACLXattr(attr) {
+		return n.getACLXattr(attr)
+	}
+	if err := checkXattr(attr, privileged, false); err != nil {
+		return nil, err
+	}
+	v, ok := n.xattrs[attr]
+	if !ok {
+		return nil, ErrNoAttr
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (n xattrNode) set(attr string, value []byte, flags int, uid uint32, privileged bool) error {
+	if isACLXattr(attr) {
+		if err := n.setACLXattr(attr, value, uid, privileged); err != nil {
+			return err
+		}
+		n.changed(OpChmod)
+		return nil
+	}
+	if err := checkXattr(attr, privileged, true); err != nil {
+		return err
+	}
+	mode := n.mode
+	if n.dir != nil {
+		mode |= os.ModeDir
+	}
+	if !userXattrAllowed(attr, mode) {
+		return ErrNotPermitted
+	}
+	if len(value) > XattrSizeMax {
+		return ErrRange
+	}
+	old, exists := n.xattrs[attr]
+	if flags&XattrCreate != 0 && exists {
+		return ErrExists
+	}
+	if flags&XattrReplace != 0 && !exists {
+		return ErrNoAttr
+	}
+	total := n.xattrs.size() + len(value) - len(old)
+	if !exists {
+		total += len(attr) + 1
+	}
+	if total > XattrListMax {
+		return ErrNoSpace
+	}
+	if n.xattrs == nil {
+		n.xattrs = make(xattrSet)
+	}
+	n.xattrs[attr] = append([]byte{}, value...)
+	n.changed(OpChmod)
+	return nil
+}
+
+func (n xattrNode) list(privileged bool) []string {
+	names := n.aclXattrs()
+	for a := range n.xattrs {
+		if strings.HasPrefix(a, "trusted.") && !privileged {
+			continue
+		}
+		names = append(names, a)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n xattrNode) remove(attr string, uid uint32, privileged bool) error {
+	if isACLXattr(attr) {
+		if err := n.removeACLXattr(attr, uid, privileged); err != nil {
+			return err
+		}
+		n.changed(OpChmod)
+		return nil
+	}
+	if err := checkXattr(attr, privileged, true); err != nil {
+		return err
+	}
+	if _, ok := n.xattrs[attr]; !ok {
+		return ErrNoAttr
+	}
+	delete(n.xattrs, attr)
+	n.changed(OpChmod)
+	return nil
+}
+
+// strings returns all extended attributes of the node, including ACLs, as used by rio metadata
+func (n xattrNode) strings() map[string]string {
+	names := n.list(true)
+	if len(names) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(names))
+	for _, a := range names {
+		v, _ := n.get(a, true)
+		m[a] = string(v)
+	}
+	return m
+}
+
+// adopt takes on attributes read from disk, interpreting any ACLs among them
+func (n xattrNode) adopt(x xattrSet) {
+	for _, attr := range []string{XattrACLAccess, XattrACLDefault} {
+		if v, ok := x[attr]; ok {
+			delete(x, attr)
+			n.setACLXattr(attr, v, 0, true)
+		}
+	}
+	if len(x) > 0 {
+		n.xattrs = x
+	}
+}
+
+func (b *Billy) xattrNode(name string) (xattrNode, error) {
+	info, err := b.getFileInfo(name, true)
+	if err != nil {
+		return xattrNode{}, err
+	}
+	switch i := info.(type) {
+	case *File:
+		return xattrNodeOf(i, nil), nil
+	case *DirMeta:
+		return xattrNodeOf(nil, i.Tree), nil
+	}
+	return xattrNode{}, os.ErrInvalid
+}
+
+// writeXattr checks the view may change an extended attribute. ACLs are guarded by
+// ownership instead, so only other attributes need write permission.
+func (b *Billy) writeXattr(n xattrNode, attr string) error {
+	if isACLXattr(attr) {
+		return nil
+	}
+	return b.access(n.inode, AccessWrite)
+}
+
+// Getxattr returns the value of an extended attribute
+func (b *Billy) Getxattr(name, attr string) ([]byte, error) {
+	n, err := b.xattrNode(name)
+	if err != nil {
+		return nil, pathError("getxattr", name, err)
+	}
+	v, err := n.get(attr, b.euid == 0)
+	if err != nil {
+		return nil, pathError("getxattr", name, err)
+	}
+	return v, nil
+}
+
+// Setxattr sets the value of an extended attribute
+func (b *Billy) Setxattr(name, attr string, value []byte, flags int) error {
+	n, err := b.xattrNode(name)
+	if err != nil {
+		return pathError("setxattr", name, err)
+	}
+	if err := b.writeXattr(n, attr); err != nil {
+		return pathError("setxattr", name, err)
+	}
+	return pathError("setxattr", name, n.set(attr, value, flags, b.euid, b.euid == 0))
+}
+
+// Listxattr lists the names of extended attributes
+func (b *Billy) Listxattr(name string) ([]string, error) {
+	n, err := b.xattrNode(name)
+	if err != nil {
+		return nil, pathError("listxattr", name, err)
+	}
+	return n.list(b.euid == 0), nil
+}
+
+// Removexattr removes an extended attribute
+func (b *Billy) Removexattr(name, attr string) error {
+	n, err := b.xattrNode(name)
+	if err != nil {
+		return pathError("removexattr", name, err)
+	}
+	if err := b.writeXattr(n, attr); err != nil {
+		return pathError("removexattr", name, err)
+	}
+	return pathError("removexattr", name, n.remove(attr, b.euid, b.euid == 0))
+}
+
+func (p *Placer) xattrNode(path fs.RelPath) (xattrNode, error) {
+	f, d, err := p.get(path, true)
+	if err != nil {
+		return xattrNode{}, err
+	}
+	return xattrNodeOf(f, d), nil
+}
+
+// Getxattr returns the value of an extended attribute
+func (p *Placer) Getxattr(path fs.RelPath, attr string) ([]byte, error) {
+	n, err := p.xattrNode(path)
+	if err != nil {
+		return nil, pathError("getxattr", path.String(), err)
+	}
+	v, err := n.get(attr, true)
+	if err != nil {
+		return nil, pathError("getxattr", path.String(), err)
+	}
+	return v, nil
+}
+
+// Setxattr sets the value of an extended attribute
+func (p *Placer) Setxattr(path fs.RelPath, attr string, value []byte, flags int) error {
+	n, err := p.xattrNode(path)
+	if err != nil {
+		return pathError("setxattr", path.String(), err)
+	}
+	return pathError("setxattr", path.String(), n.set(attr, value, flags, 0, true))
+}
+
+// Listxattr lists the names of extended attributes
+func (p *Placer) Listxattr(path fs.RelPath) ([]string, error) {
+	n, err := p.xattrNode(path)
+	if err != nil {
+		return nil, pathError("listxattr", path.String(), err)
+	}
+	return n.list(true), nil
+}
+
+// Removexattr removes an extended attribute
+func (p *Placer) Removexattr(path fs.RelPath, attr string) error {
+	n, err := p.xattrNode(path)
+	if err != nil {
+		return pathError("removexattr", path.String(), err)
+	}
+	return pathError("removexattr", path.String(), n.remove(attr, 0, true))
+}
@@ -0,0 +1,69 @@
+package memphis
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestXattr(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	if err := b.Setxattr("f", "user.a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Setxattr("f", "trusted.b", []byte("2"), XattrCreate); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := b.Getxattr("f", "user.a"); err != nil || string(v) != "1" {
+		t.Errorf("Getxattr = %q, %v", v, err)
+	}
+	if names, _ := b.Listxattr("f"); strings.Join(names, ",") != "trusted.b,user.a" {
+		t.Errorf("Listxattr = %v", names)
+	}
+	// trusted attributes are hidden from unprivileged users
+	if names, _ := root.AsBillyFS(1, 1).Listxattr("f"); strings.Join(names, ",") != "user.a" {
+		t.Errorf("unprivileged Listxattr = %v", names)
+	}
+	if err := b.Removexattr("f", "user.a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Getxattr("f", "user.a"); !errors.Is(err, ErrNoAttr) {
+		t.Errorf("Getxattr of a removed attribute = %v, want ErrNoAttr", err)
+	}
+}
+
+func TestXattrErrors(t *testing.T) {
+	root := New()
+	mustWrite(t, root, "f", "data")
+	b := root.AsBillyFS(0, 0)
+	b.Setxattr("f", "user.a", []byte("1"), 0)
+
+	for _, c := range []struct {
+		name  string
+		attr  string
+		value string
+		flags int
+		want  error
+	}{
+		{"create existing", "user.a", "2", XattrCreate, ErrExists},
+		{"replace missing", "user.b", "2", XattrReplace, ErrNoAttr},
+		{"unknown namespace", "other.a", "2", 0, ErrNotSupported},
+		{"empty name", "", "2", 0, ErrRange},
+		{"oversized value", "user.c", strings.Repeat("v", XattrSizeMax+1), 0, ErrRange},
+	} {
+		if err := b.Setxattr("f", c.attr, []byte(c.value), c.flags); !errors.Is(err, c.want) {
+			t.Errorf("%s: Setxattr = %v, want %v", c.name, err, c.want)
+		}
+	}
+	if _, err := root.Create("owned", 1, 1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AsBillyFS(1, 1).Setxattr("owned", "trusted.a", nil, 0); !errors.Is(err, ErrNotPermitted) {
+		t.Errorf("unprivileged Setxattr of a trusted attribute = %v, want ErrNotPermitted", err)
+	}
+	if _, err := b.Getxattr("missing", "user.a"); err == nil {
+		t.Error("Getxattr of a missing file succeeded")
+	}
+}